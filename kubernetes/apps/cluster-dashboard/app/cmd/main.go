@@ -9,21 +9,30 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/pi-cluster/cluster-dashboard/internal/audit"
 	"github.com/pi-cluster/cluster-dashboard/internal/handlers"
+	"github.com/pi-cluster/cluster-dashboard/internal/history"
 	"github.com/pi-cluster/cluster-dashboard/internal/k8s"
 	"github.com/pi-cluster/cluster-dashboard/internal/metrics"
+	"github.com/pi-cluster/cluster-dashboard/internal/store"
 	"github.com/pi-cluster/cluster-dashboard/internal/talos"
+	"github.com/pi-cluster/cluster-dashboard/internal/upgrade"
 )
 
 func main() {
 	log.Println("Starting Cluster Dashboard...")
 
+	// Root context for background work, cancelled on shutdown
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
 	// Initialize Kubernetes client
 	k8sClient, err := k8s.NewClient()
 	if err != nil {
 		log.Fatalf("Failed to create Kubernetes client: %v", err)
 	}
-	log.Println("Kubernetes client initialized")
+	k8sClient.Start(ctx)
+	log.Println("Kubernetes client initialized, informer caches syncing")
 
 	// Initialize Talos client
 	talosClient, err := talos.NewClient()
@@ -33,18 +42,88 @@ func main() {
 	} else {
 		log.Println("Talos client initialized")
 	}
+	// Disk and network counters are sampled in the background so rates span a fixed interval
+	talosClient.StartSampler(ctx, 30*time.Second)
 
-	// Create metrics collector with 30-second cache
-	collector := metrics.NewMetricsCollector(k8sClient, talosClient, 30*time.Second)
-	log.Println("Metrics collector initialized")
+	// Metrics are collected in the background every REFRESH_INTERVAL and served from the cache
+	refreshInterval := 30 * time.Second
+	if interval, err := time.ParseDuration(os.Getenv("REFRESH_INTERVAL")); err == nil && interval > 0 {
+		refreshInterval = interval
+	}
+	collector := metrics.NewMetricsCollector(k8sClient, talosClient, refreshInterval)
+	// Each source gets SOURCE_TIMEOUT and a whole collect COLLECT_BUDGET; a slow
+	// Pi cluster may need more, a short REFRESH_INTERVAL less
+	sourceTimeout := metrics.DefaultSourceTimeout
+	if d, err := time.ParseDuration(os.Getenv("SOURCE_TIMEOUT")); err == nil && d > 0 {
+		sourceTimeout = d
+	}
+	collectBudget := metrics.DefaultCollectBudget
+	if d, err := time.ParseDuration(os.Getenv("COLLECT_BUDGET")); err == nil && d > 0 {
+		collectBudget = d
+	}
+	collector.SetLimits(sourceTimeout, collectBudget)
+	// Every collect is kept in memory, downsampled, for the sparklines and /api/v1/history.
+	// Hourly buckets are kept for HISTORY_RETENTION.
+	retention := 7 * 24 * time.Hour
+	if d, err := time.ParseDuration(os.Getenv("HISTORY_RETENTION")); err == nil && d >= 24*time.Hour {
+		retention = d
+	}
+	metricsHistory := history.New(retention)
+	collector.AddRecorder(metricsHistory)
+
+	// With STORE_PATH set, the history, state transitions and Warning events are
+	// also saved to disk and the history is restored from it
+	var historyStore *store.Store
+	if path := os.Getenv("STORE_PATH"); path != "" {
+		historyStore, err = store.Open(path, retention, metricsHistory, k8sClient)
+		if err != nil {
+			log.Printf("Warning: Failed to open history store: %v", err)
+			log.Println("Continuing with in-memory history only...")
+		} else {
+			collector.AddRecorder(historyStore)
+			historyStore.Start(ctx)
+			log.Printf("History store opened at %s, keeping %s", path, retention)
+		}
+	}
+	collector.Start(ctx, refreshInterval)
+	log.Printf("Metrics collector initialized, refreshing every %s", refreshInterval)
 
 	// Create dashboard handler
-	dashboardHandler, err := handlers.NewDashboardHandler(collector)
+	dashboardHandler, err := handlers.NewDashboardHandler(collector, k8sClient, metricsHistory)
 	if err != nil {
 		log.Fatalf("Failed to create dashboard handler: %v", err)
 	}
 	log.Println("Dashboard handler initialized")
 
+	// Admin actions are authenticated and every one is audit-logged
+	adminAuth := handlers.NewAdminAuth(audit.NewLog(200))
+	if adminAuth.Enabled() {
+		log.Println("Admin actions enabled")
+	} else {
+		log.Println("Admin actions disabled (ADMIN_USERNAME/ADMIN_PASSWORD not set)")
+	}
+	fluxHandler, err := handlers.NewFluxHandler(k8sClient, adminAuth)
+	if err != nil {
+		log.Fatalf("Failed to create flux handler: %v", err)
+	}
+
+	// Rolling Talos and Kubernetes upgrades keep their progress in a ConfigMap shared by the replicas
+	orchestrator := upgrade.NewOrchestrator(ctx, k8sClient, talosClient, k8sClient)
+	upgradeHandler, err := handlers.NewUpgradeHandler(orchestrator, adminAuth, talosClient.InstallerRepository())
+	if err != nil {
+		log.Fatalf("Failed to create upgrade handler: %v", err)
+	}
+
+	// Node maintenance: cordon, drain and power actions through the Talos API
+	nodeHandler, err := handlers.NewNodeHandler(ctx, k8sClient, talosClient, adminAuth)
+	if err != nil {
+		log.Fatalf("Failed to create node handler: %v", err)
+	}
+	logHandler, err := handlers.NewLogHandler(ctx, talosClient)
+	if err != nil {
+		log.Fatalf("Failed to create log handler: %v", err)
+	}
+
 	// Setup HTTP routes
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", dashboardHandler.ServeIndex)
@@ -52,6 +131,26 @@ func main() {
 	mux.HandleFunc("/metrics/html", dashboardHandler.ServeMetricsHTML)
 	mux.HandleFunc("/healthz", dashboardHandler.ServeHealth)
 	mux.HandleFunc("/readiness", dashboardHandler.ServeReadiness)
+	mux.HandleFunc("GET /api/v1/history", dashboardHandler.ServeHistory)
+	mux.HandleFunc("GET /flux/helmreleases/{namespace}/{name}", fluxHandler.ServeHelmRelease)
+	mux.HandleFunc("GET /flux/kustomizations/{namespace}/{name}", fluxHandler.ServeKustomization)
+	mux.HandleFunc("POST /flux/{kind}/{namespace}/{name}/{action}", adminAuth.Require(fluxHandler.ServeAction))
+	mux.HandleFunc("GET /api/v1/audit", adminAuth.Require(adminAuth.ServeAuditLog))
+	mux.HandleFunc("GET /upgrade", upgradeHandler.ServeUpgrade)
+	mux.HandleFunc("GET /upgrade/progress", upgradeHandler.ServeUpgrade)
+	mux.HandleFunc("GET /api/v1/upgrade", upgradeHandler.ServeUpgradeJSON)
+	mux.HandleFunc("POST /upgrade/{action}", adminAuth.Require(upgradeHandler.ServeAction))
+	mux.HandleFunc("GET /nodes/{name}/drain", adminAuth.Require(nodeHandler.ServeDrain))
+	mux.HandleFunc("GET /nodes/{name}/drain/pods", adminAuth.Require(nodeHandler.ServeDrain))
+	mux.HandleFunc("POST /nodes/{name}/{action}", adminAuth.Require(nodeHandler.ServeAction))
+	// Node logs can carry addresses, tokens and other secrets, so only admins read them
+	mux.HandleFunc("GET /talos/nodes/{node}/logs", adminAuth.Require(logHandler.ServeLogs))
+	mux.HandleFunc("GET /talos/nodes/{node}/logs/stream", adminAuth.Require(logHandler.ServeStream))
+	if historyStore != nil {
+		timelineHandler := handlers.NewTimelineHandler(historyStore)
+		mux.HandleFunc("GET /api/v1/transitions", timelineHandler.ServeTransitions)
+		mux.HandleFunc("GET /api/v1/events", timelineHandler.ServeEvents)
+	}
 
 	// Create HTTP server
 	port := os.Getenv("PORT")
@@ -81,13 +180,20 @@ func main() {
 	<-quit
 
 	log.Println("Shutting down server...")
+	cancel()
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer shutdownCancel()
 
-	if err := server.Shutdown(ctx); err != nil {
+	if err := server.Shutdown(shutdownCtx); err != nil {
 		log.Fatalf("Server forced to shutdown: %v", err)
 	}
 
+	if historyStore != nil {
+		if err := historyStore.Close(); err != nil {
+			log.Printf("Error closing history store: %v", err)
+		}
+	}
+
 	log.Println("Server stopped")
 }
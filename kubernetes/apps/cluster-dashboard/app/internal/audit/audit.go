@@ -0,0 +1,61 @@
+package audit
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// Entry records a single state-changing action taken from the dashboard
+type Entry struct {
+	Time   time.Time `json:"time"`
+	User   string    `json:"user"`
+	Remote string    `json:"remote"`
+	Action string    `json:"action"`
+	Target string    `json:"target"`
+	Result string    `json:"result"` // "ok" or "failed"
+	Error  string    `json:"error,omitempty"`
+}
+
+// Log writes every action to the process log and keeps the most recent
+// entries in memory so they can be shown in the dashboard
+type Log struct {
+	mu      sync.Mutex
+	entries []Entry
+	size    int
+}
+
+// NewLog creates an audit log that retains the last size entries
+func NewLog(size int) *Log {
+	return &Log{size: size}
+}
+
+// Record stores an entry and writes it to the process log
+func (l *Log) Record(entry Entry) {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+
+	log.Printf("audit: user=%q remote=%s action=%s target=%s result=%s error=%q",
+		entry.User, entry.Remote, entry.Action, entry.Target, entry.Result, entry.Error)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.entries = append(l.entries, entry)
+	if len(l.entries) > l.size {
+		l.entries = l.entries[len(l.entries)-l.size:]
+	}
+}
+
+// Recent returns the retained entries, newest first
+func (l *Log) Recent() []Entry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	recent := make([]Entry, len(l.entries))
+	for i, entry := range l.entries {
+		recent[len(l.entries)-1-i] = entry
+	}
+	return recent
+}
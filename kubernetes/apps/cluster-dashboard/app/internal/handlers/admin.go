@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/pi-cluster/cluster-dashboard/internal/audit"
+)
+
+// adminUserKey carries the authenticated admin user through the request context
+type adminUserKey struct{}
+
+// AdminAuth guards state-changing endpoints with HTTP basic auth.
+// Credentials come from ADMIN_USERNAME and ADMIN_PASSWORD; when either is
+// unset, admin actions are disabled entirely.
+type AdminAuth struct {
+	username string
+	password string
+	audit    *audit.Log
+}
+
+// NewAdminAuth creates the admin guard from the environment
+func NewAdminAuth(auditLog *audit.Log) *AdminAuth {
+	return &AdminAuth{
+		username: os.Getenv("ADMIN_USERNAME"),
+		password: os.Getenv("ADMIN_PASSWORD"),
+		audit:    auditLog,
+	}
+}
+
+// Enabled reports whether admin credentials are configured
+func (a *AdminAuth) Enabled() bool {
+	return a.username != "" && a.password != ""
+}
+
+// Require wraps a handler so it only runs for an authenticated admin. Browsers
+// resend basic auth credentials on any request to the dashboard, so
+// state-changing requests must also come from the dashboard's own pages.
+func (a *AdminAuth) Require(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !a.Enabled() {
+			http.Error(w, "Admin actions are disabled", http.StatusForbidden)
+			return
+		}
+		if !safeMethod(r.Method) && !sameOrigin(r) {
+			http.Error(w, "Cross-site request refused", http.StatusForbidden)
+			return
+		}
+
+		user, pass, ok := r.BasicAuth()
+		userMatch := subtle.ConstantTimeCompare([]byte(user), []byte(a.username)) == 1
+		passMatch := subtle.ConstantTimeCompare([]byte(pass), []byte(a.password)) == 1
+		if !ok || !userMatch || !passMatch {
+			w.Header().Set("WWW-Authenticate", `Basic realm="cluster-dashboard admin", charset="UTF-8"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next(w, r.WithContext(context.WithValue(r.Context(), adminUserKey{}, user)))
+	}
+}
+
+// safeMethod reports whether a request method does not change state
+func safeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// sameOrigin reports whether a request was made by the dashboard's own pages:
+// htmx sets HX-Request, which a cross-site form cannot and a cross-origin script
+// only can after a CORS preflight the dashboard never allows. Other clients have
+// to send an Origin, or failing that a Referer, on the dashboard's host.
+func sameOrigin(r *http.Request) bool {
+	if r.Header.Get("HX-Request") == "true" {
+		return true
+	}
+	source := r.Header.Get("Origin")
+	if source == "" {
+		source = r.Header.Get("Referer")
+	}
+	if source == "" {
+		return false
+	}
+	u, err := url.Parse(source)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	host := r.Host
+	if forwarded := r.Header.Get("X-Forwarded-Host"); forwarded != "" {
+		host = forwarded
+	}
+	return u.Host == host
+}
+
+// Record writes an audit entry for an admin action on target
+func (a *AdminAuth) Record(r *http.Request, action, target string, err error) {
+	a.recordAs(adminUser(r), clientAddr(r), action, target, err)
+}
+
+// recordAs writes an audit entry outside a request, e.g. when an action
+// started by user finishes in the background
+func (a *AdminAuth) recordAs(user, remote, action, target string, err error) {
+	entry := audit.Entry{
+		User:   user,
+		Remote: remote,
+		Action: action,
+		Target: target,
+		Result: "ok",
+	}
+	if err != nil {
+		entry.Result = "failed"
+		entry.Error = err.Error()
+	}
+	a.audit.Record(entry)
+}
+
+// adminUser returns the admin user authenticated by Require
+func adminUser(r *http.Request) string {
+	user, _ := r.Context().Value(adminUserKey{}).(string)
+	return user
+}
+
+// ServeAuditLog serves the recent audit entries as JSON
+func (a *AdminAuth) ServeAuditLog(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(a.audit.Recent())
+}
+
+// clientAddr returns the original client address when behind Traefik
+func clientAddr(r *http.Request) string {
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		return forwarded
+	}
+	return r.RemoteAddr
+}
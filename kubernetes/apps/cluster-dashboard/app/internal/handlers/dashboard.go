@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
 	"html/template"
 	"log"
 	"net/http"
@@ -12,14 +13,107 @@ import (
 	"github.com/pi-cluster/cluster-dashboard/internal/metrics"
 )
 
+// CacheSyncer reports the sync state of the informer caches behind the collector
+type CacheSyncer interface {
+	CacheSynced() map[string]bool
+}
+
+// fluxActionData feeds the "flux-actions" template for one resource row
+type fluxActionData struct {
+	Kind     string // URL kind: kustomizations or helmreleases
+	Resource metrics.FluxResource
+}
+
+// templateFuncs are the helpers available to every template
+var templateFuncs = template.FuncMap{
+	"fluxAction": func(kind string, resource metrics.FluxResource) fluxActionData {
+		return fluxActionData{Kind: kind, Resource: resource}
+	},
+	"timeAgo": func(t time.Time) string {
+		if t.IsZero() {
+			return "never"
+		}
+		return formatTimeAgo(time.Since(t))
+	},
+	"bytes": formatBytes,
+	"inc": func(i int) int {
+		return i + 1
+	},
+	// Replaced by the dashboard handler, which has the history to draw from
+	"sparkline": func(metric, node string) template.HTML {
+		return ""
+	},
+}
+
+// formatBytes formats a byte count with binary units. It takes any numeric
+// type because the metrics mix int64 (etcd), uint64 (disks, mounts) and
+// float64 (disk I/O rates).
+func formatBytes(v interface{}) string {
+	var b int64
+	switch n := v.(type) {
+	case int64:
+		b = n
+	case uint64:
+		b = int64(n)
+	case int:
+		b = int64(n)
+	case float64:
+		b = int64(n)
+	default:
+		return fmt.Sprint(v)
+	}
+
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%d B", b)
+	}
+	div, exp := int64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(b)/float64(div), "KMGTPE"[exp])
+}
+
+// formatTimeAgo formats a duration as a human-readable "ago" string
+func formatTimeAgo(d time.Duration) string {
+	if d < time.Minute {
+		return fmt.Sprintf("%ds ago", int(d.Seconds()))
+	} else if d < time.Hour {
+		return fmt.Sprintf("%dm ago", int(d.Minutes()))
+	} else if d < 24*time.Hour {
+		return fmt.Sprintf("%dh ago", int(d.Hours()))
+	}
+	return fmt.Sprintf("%dd ago", int(d.Hours()/24))
+}
+
 // DashboardHandler handles dashboard requests
 type DashboardHandler struct {
 	collector metrics.Collector
+	caches    CacheSyncer
+	history   HistoryReader
 	templates *template.Template
 }
 
 // NewDashboardHandler creates a new dashboard handler
-func NewDashboardHandler(collector metrics.Collector) (*DashboardHandler, error) {
+func NewDashboardHandler(collector metrics.Collector, caches CacheSyncer, history HistoryReader) (*DashboardHandler, error) {
+	tmpl, err := loadTemplates()
+	if err != nil {
+		return nil, err
+	}
+
+	h := &DashboardHandler{
+		collector: collector,
+		caches:    caches,
+		history:   history,
+		templates: tmpl,
+	}
+	tmpl.Funcs(template.FuncMap{"sparkline": h.sparkline})
+	return h, nil
+}
+
+// loadTemplates parses the HTML templates shared by all handlers
+func loadTemplates() (*template.Template, error) {
 	// Determine template path - support both local development and container deployment
 	templatePath := os.Getenv("TEMPLATE_PATH")
 	if templatePath == "" {
@@ -33,23 +127,20 @@ func NewDashboardHandler(collector metrics.Collector) (*DashboardHandler, error)
 	}
 
 	// Parse templates
-	tmpl, err := template.ParseGlob(templatePath)
+	tmpl, err := template.New("").Funcs(templateFuncs).ParseGlob(templatePath)
 	if err != nil {
 		// Try absolute path from current working directory
 		if !filepath.IsAbs(templatePath) {
 			wd, _ := os.Getwd()
 			absPath := filepath.Join(wd, templatePath)
-			tmpl, err = template.ParseGlob(absPath)
+			tmpl, err = template.New("").Funcs(templateFuncs).ParseGlob(absPath)
 		}
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	return &DashboardHandler{
-		collector: collector,
-		templates: tmpl,
-	}, nil
+	return tmpl, nil
 }
 
 // ServeIndex serves the main dashboard page
@@ -113,13 +204,35 @@ func (h *DashboardHandler) ServeHealth(w http.ResponseWriter, r *http.Request) {
 func (h *DashboardHandler) ServeReadiness(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	// Try to collect metrics to verify we can reach k8s API
-	_, err := h.collector.Collect(ctx)
+	// Not ready until every informer cache has completed its initial list
+	caches := h.caches.CacheSynced()
+	for _, synced := range caches {
+		if !synced {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status": "not ready",
+				"error":  "informer caches not synced",
+				"caches": caches,
+			})
+			return
+		}
+	}
+
+	// Try to collect metrics to verify we can reach k8s API. Stale data is still
+	// served, so only a Kubernetes section that was never collected fails the check.
+	clusterMetrics, err := h.collector.Collect(ctx)
+	if err == nil {
+		if section := clusterMetrics.Sections[metrics.SectionKubernetes]; section.State == metrics.SectionUnavailable {
+			err = fmt.Errorf("kubernetes status unavailable: %s", section.Error)
+		}
+	}
 	if err != nil {
 		w.WriteHeader(http.StatusServiceUnavailable)
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"status": "not ready",
 			"error":  err.Error(),
+			"caches": caches,
 		})
 		return
 	}
@@ -128,6 +241,7 @@ func (h *DashboardHandler) ServeReadiness(w http.ResponseWriter, r *http.Request
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"status":    "ready",
+		"caches":    caches,
 		"timestamp": time.Now().Format(time.RFC3339),
 	})
 }
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+
+	"github.com/pi-cluster/cluster-dashboard/internal/metrics"
+)
+
+// FluxClient reads and acts on Flux Kustomizations and HelmReleases
+type FluxClient interface {
+	GetHelmReleaseDetail(ctx context.Context, namespace, name string) (*metrics.HelmReleaseDetail, error)
+	GetKustomizationInventory(ctx context.Context, namespace, name string) (*metrics.KustomizationInventory, error)
+	ReconcileFlux(ctx context.Context, kind, namespace, name string, withSource bool) error
+	SuspendFlux(ctx context.Context, kind, namespace, name string, suspend bool) error
+}
+
+// FluxHandler handles Flux detail pages and action requests
+type FluxHandler struct {
+	flux      FluxClient
+	admin     *AdminAuth
+	templates *template.Template
+}
+
+// NewFluxHandler creates a new Flux handler
+func NewFluxHandler(flux FluxClient, admin *AdminAuth) (*FluxHandler, error) {
+	tmpl, err := loadTemplates()
+	if err != nil {
+		return nil, err
+	}
+
+	return &FluxHandler{
+		flux:      flux,
+		admin:     admin,
+		templates: tmpl,
+	}, nil
+}
+
+// ServeHelmRelease serves the detail page for one HelmRelease.
+// Route: GET /flux/helmreleases/{namespace}/{name}
+func (h *FluxHandler) ServeHelmRelease(w http.ResponseWriter, r *http.Request) {
+	detail, err := h.flux.GetHelmReleaseDetail(r.Context(), r.PathValue("namespace"), r.PathValue("name"))
+	if errors.Is(err, metrics.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting helmrelease detail: %v", err)
+		http.Error(w, "Failed to get HelmRelease", http.StatusInternalServerError)
+		return
+	}
+
+	if r.URL.Query().Get("format") == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(detail)
+		return
+	}
+
+	if err := h.templates.ExecuteTemplate(w, "helmrelease.html", detail); err != nil {
+		log.Printf("Error rendering helmrelease template: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// ServeKustomization serves the inventory browser for one Kustomization.
+// Route: GET /flux/kustomizations/{namespace}/{name}
+func (h *FluxHandler) ServeKustomization(w http.ResponseWriter, r *http.Request) {
+	inventory, err := h.flux.GetKustomizationInventory(r.Context(), r.PathValue("namespace"), r.PathValue("name"))
+	if errors.Is(err, metrics.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting kustomization inventory: %v", err)
+		http.Error(w, "Failed to get Kustomization", http.StatusInternalServerError)
+		return
+	}
+
+	if r.URL.Query().Get("format") == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(inventory)
+		return
+	}
+
+	if err := h.templates.ExecuteTemplate(w, "kustomization.html", inventory); err != nil {
+		log.Printf("Error rendering kustomization template: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// ServeAction runs a reconcile, suspend or resume on a Flux resource.
+// Route: POST /flux/{kind}/{namespace}/{name}/{action}
+func (h *FluxHandler) ServeAction(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	kind := r.PathValue("kind")
+	namespace := r.PathValue("namespace")
+	name := r.PathValue("name")
+	action := r.PathValue("action")
+
+	var err error
+	var done string
+	switch action {
+	case "reconcile":
+		err = h.flux.ReconcileFlux(ctx, kind, namespace, name, false)
+		done = "Reconcile requested"
+	case "reconcile-with-source":
+		err = h.flux.ReconcileFlux(ctx, kind, namespace, name, true)
+		done = "Source and reconcile requested"
+	case "suspend":
+		err = h.flux.SuspendFlux(ctx, kind, namespace, name, true)
+		done = "Suspended"
+	case "resume":
+		err = h.flux.SuspendFlux(ctx, kind, namespace, name, false)
+		done = "Resumed"
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	target := fmt.Sprintf("%s/%s/%s", kind, namespace, name)
+	h.admin.Record(r, "flux-"+action, target, err)
+
+	if err != nil {
+		log.Printf("Error running flux %s on %s: %v", action, target, err)
+		writeActionResult(w, r, http.StatusInternalServerError, "Failed: "+err.Error())
+		return
+	}
+	writeActionResult(w, r, http.StatusOK, done)
+}
+
+// writeActionResult answers htmx requests with a fragment and everything else with JSON
+func writeActionResult(w http.ResponseWriter, r *http.Request, status int, message string) {
+	if r.Header.Get("HX-Request") == "true" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(status)
+		fmt.Fprint(w, template.HTMLEscapeString(message))
+		return
+	}
+
+	result := "ok"
+	if status >= http.StatusBadRequest {
+		result = "failed"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  result,
+		"message": message,
+	})
+}
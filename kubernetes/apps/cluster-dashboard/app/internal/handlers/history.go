@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pi-cluster/cluster-dashboard/internal/history"
+	"github.com/pi-cluster/cluster-dashboard/internal/metrics"
+)
+
+// Sparkline size in pixels and the window it covers, at 1m resolution
+const (
+	sparklineWidth  = 60
+	sparklineHeight = 16
+	sparklineWindow = time.Hour
+)
+
+// HistoryReader returns the recorded history of a metric
+type HistoryReader interface {
+	Series(metric, node string, resolution time.Duration) (*metrics.HistorySeries, error)
+}
+
+// ServeHistory serves the history of a metric on a node, or the cluster
+// average when node is omitted, as JSON.
+// Route: GET /api/v1/history?metric=cpu|memory|temperature&node=&resolution=1m|5m|1h
+func (h *DashboardHandler) ServeHistory(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	metric, node := query.Get("metric"), query.Get("node")
+	switch metric {
+	case metrics.HistoryCPU, metrics.HistoryMemory:
+	case metrics.HistoryTemperature:
+		if node == "" {
+			http.Error(w, "temperature is only kept per node", http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "metric must be cpu, memory or temperature", http.StatusBadRequest)
+		return
+	}
+
+	resolution := time.Minute
+	if value := query.Get("resolution"); value != "" {
+		var err error
+		if resolution, err = time.ParseDuration(value); err != nil {
+			http.Error(w, "resolution must be 1m, 5m or 1h", http.StatusBadRequest)
+			return
+		}
+	}
+
+	series, err := h.history.Series(metric, node, resolution)
+	switch {
+	case errors.Is(err, history.ErrInvalidResolution):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, metrics.ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		log.Printf("Error reading %s history: %v", metric, err)
+		http.Error(w, "Failed to read history", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(series)
+}
+
+// sparkline draws the last hour of a metric as an inline SVG, or nothing until
+// there are two minutes to draw. Percentages are drawn on a fixed 0-100 scale
+// so nodes compare at a glance; temperature is scaled to its own range.
+func (h *DashboardHandler) sparkline(metric, node string) template.HTML {
+	series, err := h.history.Series(metric, node, time.Minute)
+	if err != nil {
+		return ""
+	}
+	end := time.Now().Truncate(time.Minute)
+	start := end.Add(-sparklineWindow)
+	var points []metrics.HistoryPoint
+	for _, point := range series.Points {
+		if !point.Time.Before(start) {
+			points = append(points, point)
+		}
+	}
+	if len(points) < 2 {
+		return ""
+	}
+
+	low, high := 0.0, 100.0
+	unit := "%"
+	if metric == metrics.HistoryTemperature {
+		unit = "°C"
+		low, high = points[0].Avg, points[0].Avg
+		for _, point := range points {
+			low, high = min(low, point.Avg), max(high, point.Avg)
+		}
+		// Keep small wobbles flat instead of stretching them across the height
+		if pad := (10 - (high - low)) / 2; pad > 0 {
+			low, high = low-pad, high+pad
+		}
+	}
+
+	// Gaps in collection stay visible as straight segments over the missing minutes
+	coords := make([]string, len(points))
+	lowest, highest := points[0].Min, points[0].Max
+	for i, point := range points {
+		x := float64(point.Time.Sub(start)) / float64(sparklineWindow) * sparklineWidth
+		y := sparklineHeight - (point.Avg-low)/(high-low)*sparklineHeight
+		y = min(max(y, 1), sparklineHeight-1)
+		coords[i] = fmt.Sprintf("%.1f,%.1f", x, y)
+		lowest, highest = min(lowest, point.Min), max(highest, point.Max)
+	}
+
+	return template.HTML(fmt.Sprintf(
+		`<svg class="sparkline" width="%d" height="%d" viewBox="0 0 %d %d" role="img"><title>Last hour: %.1f–%.1f%s</title><polyline points="%s"/></svg>`,
+		sparklineWidth, sparklineHeight, sparklineWidth, sparklineHeight,
+		lowest, highest, unit, strings.Join(coords, " ")))
+}
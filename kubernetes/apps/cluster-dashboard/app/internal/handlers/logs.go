@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pi-cluster/cluster-dashboard/internal/metrics"
+)
+
+// Log viewer limits. Lines are tailed before the filter is applied.
+const (
+	defaultLogTail = 200
+	maxLogTail     = 5000
+	logKeepAlive   = 30 * time.Second // Comment sent on a quiet followed stream so proxies keep it open
+	logBuffer      = 256              // Lines queued between the Talos stream and the browser
+)
+
+// LogStreamer streams Talos service logs and the kernel ring buffer of a node
+type LogStreamer interface {
+	StreamLogs(ctx context.Context, node, source string, follow bool, tail int, emit func(line string)) error
+}
+
+// LogHandler serves the per-node log viewer and its Server-Sent Events stream
+type LogHandler struct {
+	logs      LogStreamer
+	templates *template.Template
+	ctx       context.Context // Open streams end when it is cancelled
+}
+
+// logQuery is a log view: which log, how much of it and which lines to show
+type logQuery struct {
+	Source string
+	Tail   int
+	Follow bool
+	Filter string // Substring (case-insensitive) or regular expression lines must match
+	Regex  bool
+	match  func(line string) bool
+}
+
+// logsPage is the data behind logs.html
+type logsPage struct {
+	Node    string
+	Sources []string
+	Query   logQuery
+	Stream  string // URL of the event stream for Query
+	Error   string
+}
+
+// NewLogHandler creates a new log handler. Streams still open when ctx is
+// cancelled are ended, so they do not hold up a graceful shutdown.
+func NewLogHandler(ctx context.Context, logs LogStreamer) (*LogHandler, error) {
+	tmpl, err := loadTemplates()
+	if err != nil {
+		return nil, err
+	}
+
+	return &LogHandler{
+		logs:      logs,
+		templates: tmpl,
+		ctx:       ctx,
+	}, nil
+}
+
+// ServeLogs serves the log viewer page for a Talos node.
+// Route: GET /talos/nodes/{node}/logs?source=&tail=&follow=&filter=&regex=
+func (h *LogHandler) ServeLogs(w http.ResponseWriter, r *http.Request) {
+	node := r.PathValue("node")
+	page := logsPage{Node: node, Sources: metrics.LogSources}
+
+	query, err := parseLogQuery(r.URL.Query())
+	if err != nil {
+		page.Error = err.Error()
+	} else {
+		page.Stream = "/talos/nodes/" + url.PathEscape(node) + "/logs/stream?" + r.URL.RawQuery
+	}
+	page.Query = query
+
+	if err := h.templates.ExecuteTemplate(w, "logs.html", page); err != nil {
+		log.Printf("Error rendering logs template: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// ServeStream streams log lines as Server-Sent Events: a message per line, then
+// an "end" event when the log is exhausted or a "failed" event with the error.
+// Route: GET /talos/nodes/{node}/logs/stream, with the query of ServeLogs
+func (h *LogHandler) ServeStream(w http.ResponseWriter, r *http.Request) {
+	node := r.PathValue("node")
+	query, err := parseLogQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	// A followed stream outlives the server's WriteTimeout
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("Error clearing write deadline for log stream: %v", err)
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	stop := context.AfterFunc(h.ctx, cancel)
+	defer stop()
+
+	lines := make(chan string, logBuffer)
+	done := make(chan error, 1)
+	go func() {
+		done <- h.logs.StreamLogs(ctx, node, query.Source, query.Follow, query.Tail, func(line string) {
+			select {
+			case lines <- line:
+			case <-ctx.Done():
+			}
+		})
+	}()
+
+	keepAlive := time.NewTicker(logKeepAlive)
+	defer keepAlive.Stop()
+	send := func(line string) {
+		if query.match(line) {
+			writeEvent(w, "", line)
+		}
+	}
+	for {
+		select {
+		case line := <-lines:
+			send(line)
+			if len(lines) == 0 {
+				flusher.Flush()
+			}
+		case err := <-done:
+			// Every line was queued before StreamLogs returned
+			for len(lines) > 0 {
+				send(<-lines)
+			}
+			switch {
+			case ctx.Err() != nil:
+				return
+			case err != nil:
+				if !errors.Is(err, metrics.ErrNotFound) {
+					log.Printf("Error streaming %s logs from %s: %v", query.Source, node, err)
+				}
+				writeEvent(w, "failed", err.Error())
+			default:
+				writeEvent(w, "end", "end of log")
+			}
+			flusher.Flush()
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// parseLogQuery reads the log view options, defaulting to the last
+// defaultLogTail lines of the kubelet log
+func parseLogQuery(values url.Values) (logQuery, error) {
+	query := logQuery{
+		Source: values.Get("source"),
+		Tail:   defaultLogTail,
+		Follow: values.Get("follow") != "",
+		Filter: values.Get("filter"),
+		Regex:  values.Get("regex") != "",
+		match:  func(string) bool { return true },
+	}
+	if query.Source == "" {
+		query.Source = metrics.LogSources[0]
+	}
+	if tail := values.Get("tail"); tail != "" {
+		n, err := strconv.Atoi(tail)
+		if err != nil || n < 1 || n > maxLogTail {
+			return query, fmt.Errorf("tail must be between 1 and %d lines", maxLogTail)
+		}
+		query.Tail = n
+	}
+
+	switch {
+	case query.Filter == "":
+	case query.Regex:
+		re, err := regexp.Compile(query.Filter)
+		if err != nil {
+			return query, fmt.Errorf("invalid filter: %v", err)
+		}
+		query.match = re.MatchString
+	default:
+		filter := strings.ToLower(query.Filter)
+		query.match = func(line string) bool {
+			return strings.Contains(strings.ToLower(line), filter)
+		}
+	}
+	return query, nil
+}
+
+// writeEvent writes one Server-Sent Event. A carriage return would end the
+// data field early, so it is dropped.
+func writeEvent(w http.ResponseWriter, event, data string) {
+	if event != "" {
+		fmt.Fprintf(w, "event: %s\n", event)
+	}
+	fmt.Fprintf(w, "data: %s\n\n", strings.ReplaceAll(data, "\r", ""))
+}
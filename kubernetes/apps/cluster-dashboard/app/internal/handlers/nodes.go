@@ -0,0 +1,264 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pi-cluster/cluster-dashboard/internal/metrics"
+)
+
+// drainTimeout bounds a drain started from the dashboard. Evictions held back
+// by a PodDisruptionBudget are retried until then.
+const drainTimeout = 10 * time.Minute
+
+// errActionRefused is returned when a node action is not safe to run right now
+var errActionRefused = errors.New("refused")
+
+// NodeClient cordons and drains Kubernetes nodes
+type NodeClient interface {
+	GetNodeMetrics(ctx context.Context) ([]metrics.NodeDetail, error)
+	GetDrainPlan(ctx context.Context, name string) (*metrics.DrainPlan, error)
+	CordonNode(ctx context.Context, name string, cordon bool) error
+	DrainNode(ctx context.Context, name string, progress func(remaining []string)) error
+}
+
+// NodePowerClient reboots and shuts down nodes through the Talos API
+type NodePowerClient interface {
+	GetEtcdStatus(ctx context.Context) (*metrics.EtcdStatus, error)
+	RebootNode(ctx context.Context, nodeIP string) error
+	ShutdownNode(ctx context.Context, nodeIP string) error
+}
+
+// NodeHandler handles node maintenance: cordon, drain, reboot and shutdown
+type NodeHandler struct {
+	nodes     NodeClient
+	power     NodePowerClient
+	admin     *AdminAuth
+	templates *template.Template
+	ctx       context.Context // Drains stop when it is cancelled
+
+	mu     sync.Mutex
+	drains map[string]*drainState // Drains started from this replica, by node
+}
+
+// drainState is a drain started from this replica
+type drainState struct {
+	User       string
+	Running    bool
+	Remaining  int
+	StartedAt  time.Time
+	FinishedAt time.Time
+	Error      string
+}
+
+// drainPage is the data behind drain.html
+type drainPage struct {
+	Plan  *metrics.DrainPlan
+	Drain *drainState // nil when this replica has not drained the node
+}
+
+// NewNodeHandler creates a new node handler. Drains started from it stop when ctx is cancelled.
+func NewNodeHandler(ctx context.Context, nodes NodeClient, power NodePowerClient, admin *AdminAuth) (*NodeHandler, error) {
+	tmpl, err := loadTemplates()
+	if err != nil {
+		return nil, err
+	}
+
+	return &NodeHandler{
+		nodes:     nodes,
+		power:     power,
+		admin:     admin,
+		templates: tmpl,
+		ctx:       ctx,
+		drains:    make(map[string]*drainState),
+	}, nil
+}
+
+// ServeDrain serves the drain confirmation page listing the pods a drain evicts,
+// or only the pod list for htmx polling while the drain runs.
+// Routes: GET /nodes/{name}/drain, GET /nodes/{name}/drain/pods
+func (h *NodeHandler) ServeDrain(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	plan, err := h.nodes.GetDrainPlan(r.Context(), name)
+	if errors.Is(err, metrics.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting drain plan for %s: %v", name, err)
+		http.Error(w, "Failed to get drain plan", http.StatusInternalServerError)
+		return
+	}
+
+	if r.URL.Query().Get("format") == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(plan)
+		return
+	}
+
+	page := drainPage{Plan: plan}
+	h.mu.Lock()
+	if drain, ok := h.drains[name]; ok {
+		copied := *drain
+		page.Drain = &copied
+	}
+	h.mu.Unlock()
+
+	tmplName := "drain.html"
+	if strings.HasSuffix(r.URL.Path, "/pods") {
+		tmplName = "drain-pods"
+	}
+	if err := h.templates.ExecuteTemplate(w, tmplName, page); err != nil {
+		log.Printf("Error rendering drain template: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// ServeAction runs cordon, uncordon, drain, reboot or shutdown on a node.
+// Route: POST /nodes/{name}/{action}
+func (h *NodeHandler) ServeAction(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	name := r.PathValue("name")
+	action := r.PathValue("action")
+
+	var err error
+	var done string
+	switch action {
+	case "cordon":
+		err = h.nodes.CordonNode(ctx, name, true)
+		done = "Cordoned"
+	case "uncordon":
+		err = h.nodes.CordonNode(ctx, name, false)
+		done = "Uncordoned"
+	case "drain":
+		var evicting int
+		evicting, err = h.startDrain(ctx, name, adminUser(r), clientAddr(r))
+		done = fmt.Sprintf("Cordoned, evicting %d pods", evicting)
+	case "reboot":
+		err = h.powerAction(ctx, name, h.power.RebootNode)
+		done = "Reboot requested"
+	case "shutdown":
+		err = h.powerAction(ctx, name, h.power.ShutdownNode)
+		done = "Shutdown requested"
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	h.admin.Record(r, "node-"+action, name, err)
+
+	switch {
+	case errors.Is(err, metrics.ErrNotFound):
+		writeActionResult(w, r, http.StatusNotFound, err.Error())
+	case errors.Is(err, errActionRefused):
+		writeActionResult(w, r, http.StatusConflict, err.Error())
+	case err != nil:
+		log.Printf("Error running node %s on %s: %v", action, name, err)
+		writeActionResult(w, r, http.StatusInternalServerError, "Failed: "+err.Error())
+	default:
+		w.Header().Set("HX-Trigger", "drain-changed")
+		writeActionResult(w, r, http.StatusOK, done)
+	}
+}
+
+// startDrain cordons the node and evicts its pods in the background, like
+// kubectl drain. It refuses when pods without a controller would be lost.
+// The outcome is audit-logged under the user who started it.
+func (h *NodeHandler) startDrain(ctx context.Context, name, user, remote string) (int, error) {
+	plan, err := h.nodes.GetDrainPlan(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+	if len(plan.Unmanaged) > 0 {
+		pods := make([]string, 0, len(plan.Unmanaged))
+		for _, pod := range plan.Unmanaged {
+			pods = append(pods, pod.Namespace+"/"+pod.Name)
+		}
+		return 0, fmt.Errorf("%w: pods without a controller would be lost: %s", errActionRefused, strings.Join(pods, ", "))
+	}
+
+	// Reserve the node so a second request is refused while the cordon is in flight
+	h.mu.Lock()
+	previous, ok := h.drains[name]
+	if ok && previous.Running {
+		h.mu.Unlock()
+		return 0, fmt.Errorf("%w: a drain of %s is already running", errActionRefused, name)
+	}
+	drain := &drainState{User: user, Running: true, Remaining: len(plan.Evict), StartedAt: time.Now()}
+	h.drains[name] = drain
+	h.mu.Unlock()
+
+	if err := h.nodes.CordonNode(ctx, name, true); err != nil {
+		h.mu.Lock()
+		if previous != nil {
+			h.drains[name] = previous
+		} else {
+			delete(h.drains, name)
+		}
+		h.mu.Unlock()
+		return 0, err
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(h.ctx, drainTimeout)
+		defer cancel()
+
+		err := h.nodes.DrainNode(ctx, name, func(remaining []string) {
+			h.mu.Lock()
+			drain.Remaining = len(remaining)
+			h.mu.Unlock()
+		})
+
+		h.mu.Lock()
+		drain.Running = false
+		drain.FinishedAt = time.Now()
+		if err != nil {
+			drain.Error = err.Error()
+		}
+		h.mu.Unlock()
+		h.admin.recordAs(user, remote, "node-drain-finished", name, err)
+	}()
+	return len(plan.Evict), nil
+}
+
+// powerAction reboots or shuts down a node through the Talos API. A control
+// plane is refused while etcd is unhealthy: taking another member down could
+// lose quorum.
+func (h *NodeHandler) powerAction(ctx context.Context, name string, action func(context.Context, string) error) error {
+	nodes, err := h.nodes.GetNodeMetrics(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list nodes: %w", err)
+	}
+	var node *metrics.NodeDetail
+	for i := range nodes {
+		if nodes[i].Name == name {
+			node = &nodes[i]
+		}
+	}
+	if node == nil {
+		return fmt.Errorf("node %s: %w", name, metrics.ErrNotFound)
+	}
+	if node.IP == "" {
+		return fmt.Errorf("node %s has no internal IP to reach Talos on", name)
+	}
+
+	if node.Role == "control-plane" {
+		etcd, err := h.power.GetEtcdStatus(ctx)
+		if err != nil {
+			return fmt.Errorf("%w: etcd status unavailable, so quorum cannot be checked: %v", errActionRefused, err)
+		}
+		if !etcd.Healthy {
+			return fmt.Errorf("%w: etcd is not healthy (%s), taking %s down could lose quorum",
+				errActionRefused, strings.Join(etcd.Warnings, "; "), name)
+		}
+	}
+	return action(ctx, node.IP)
+}
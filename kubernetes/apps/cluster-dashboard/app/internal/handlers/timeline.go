@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/pi-cluster/cluster-dashboard/internal/metrics"
+)
+
+// defaultTimelineSince is how far back transitions and events go without ?since=
+const defaultTimelineSince = 24 * time.Hour
+
+// Timeline returns the persisted state transitions and Warning events
+type Timeline interface {
+	Transitions(since time.Time) ([]metrics.StateTransition, error)
+	Events(since time.Time) ([]metrics.ClusterEvent, error)
+}
+
+// TimelineHandler serves what the persistent store has seen happen
+type TimelineHandler struct {
+	timeline Timeline
+}
+
+// NewTimelineHandler creates a new timeline handler
+func NewTimelineHandler(timeline Timeline) *TimelineHandler {
+	return &TimelineHandler{timeline: timeline}
+}
+
+// ServeTransitions serves the state transitions as JSON, newest first.
+// Route: GET /api/v1/transitions?since=24h
+func (h *TimelineHandler) ServeTransitions(w http.ResponseWriter, r *http.Request) {
+	since, ok := parseSince(w, r)
+	if !ok {
+		return
+	}
+	transitions, err := h.timeline.Transitions(since)
+	if err != nil {
+		log.Printf("Error reading transitions: %v", err)
+		http.Error(w, "Failed to read transitions", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(transitions)
+}
+
+// ServeEvents serves the Kubernetes Warning events as JSON, newest first.
+// Route: GET /api/v1/events?since=24h
+func (h *TimelineHandler) ServeEvents(w http.ResponseWriter, r *http.Request) {
+	since, ok := parseSince(w, r)
+	if !ok {
+		return
+	}
+	events, err := h.timeline.Events(since)
+	if err != nil {
+		log.Printf("Error reading events: %v", err)
+		http.Error(w, "Failed to read events", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
+
+// parseSince reads ?since= as a Go duration back from now, writing a 400 when it is invalid
+func parseSince(w http.ResponseWriter, r *http.Request) (time.Time, bool) {
+	since := defaultTimelineSince
+	if value := r.URL.Query().Get("since"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			http.Error(w, "since must be a positive duration such as 24h", http.StatusBadRequest)
+			return time.Time{}, false
+		}
+		since = d
+	}
+	return time.Now().Add(-since), true
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/pi-cluster/cluster-dashboard/internal/metrics"
+	"github.com/pi-cluster/cluster-dashboard/internal/upgrade"
+)
+
+// UpgradeRunner plans and runs rolling Talos and Kubernetes upgrades
+type UpgradeRunner interface {
+	Current(ctx context.Context) (*metrics.UpgradeRun, error)
+	Preview(ctx context.Context, image, kubernetesVersion, user string) (*metrics.UpgradeRun, error)
+	Start(ctx context.Context, user string) error
+	Abort(ctx context.Context, user string) error
+}
+
+// UpgradeHandler serves the upgrade workflow page and its actions
+type UpgradeHandler struct {
+	upgrades   UpgradeRunner
+	admin      *AdminAuth
+	templates  *template.Template
+	repository string // Installer image repository suggested in the form
+}
+
+// upgradePage is the data behind upgrade.html
+type upgradePage struct {
+	Run          *metrics.UpgradeRun
+	Repository   string
+	AdminEnabled bool
+	Error        string
+}
+
+// NewUpgradeHandler creates a new upgrade handler. repository is the installer
+// image repository of the cluster's schematic, or "" when it is not known.
+func NewUpgradeHandler(upgrades UpgradeRunner, admin *AdminAuth, repository string) (*UpgradeHandler, error) {
+	tmpl, err := loadTemplates()
+	if err != nil {
+		return nil, err
+	}
+
+	return &UpgradeHandler{
+		upgrades:   upgrades,
+		admin:      admin,
+		templates:  tmpl,
+		repository: repository,
+	}, nil
+}
+
+// ServeUpgrade serves the upgrade page, or only its progress section for htmx polling.
+// Routes: GET /upgrade, GET /upgrade/progress
+func (h *UpgradeHandler) ServeUpgrade(w http.ResponseWriter, r *http.Request) {
+	page := upgradePage{
+		Repository:   h.repository,
+		AdminEnabled: h.admin.Enabled(),
+	}
+	run, err := h.upgrades.Current(r.Context())
+	if err != nil {
+		log.Printf("Error loading upgrade state: %v", err)
+		page.Error = err.Error()
+	}
+	page.Run = run
+
+	name := "upgrade.html"
+	if r.URL.Path == "/upgrade/progress" {
+		name = "upgrade-progress"
+	}
+	if err := h.templates.ExecuteTemplate(w, name, page); err != nil {
+		log.Printf("Error rendering upgrade template: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// ServeUpgradeJSON serves the current run as JSON, null when there is none.
+// Route: GET /api/v1/upgrade
+func (h *UpgradeHandler) ServeUpgradeJSON(w http.ResponseWriter, r *http.Request) {
+	run, err := h.upgrades.Current(r.Context())
+	if err != nil {
+		log.Printf("Error loading upgrade state: %v", err)
+		http.Error(w, "Failed to load upgrade state", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(run)
+}
+
+// ServeAction previews, starts, resumes or aborts an upgrade.
+// Route: POST /upgrade/{action}
+func (h *UpgradeHandler) ServeAction(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	action := r.PathValue("action")
+	user := adminUser(r)
+
+	var err error
+	var done string
+	target := "cluster"
+	switch action {
+	case "preview":
+		var run *metrics.UpgradeRun
+		image, kubernetes := r.FormValue("image"), r.FormValue("kubernetes_version")
+		target = strings.TrimSpace(image + " " + kubernetes)
+		run, err = h.upgrades.Preview(ctx, image, kubernetes, user)
+		if err == nil {
+			done = "Planned the upgrade to " + upgrade.Targets(run) + ": check the order below, then start it"
+		}
+	case "start":
+		err = h.upgrades.Start(ctx, user)
+		done = "Upgrade started"
+	case "resume":
+		err = h.upgrades.Start(ctx, user)
+		done = "Upgrade resumed"
+	case "abort":
+		err = h.upgrades.Abort(ctx, user)
+		done = "Upgrade aborted"
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	h.admin.Record(r, "upgrade-"+action, target, err)
+
+	switch {
+	case errors.Is(err, upgrade.ErrInvalidState):
+		writeActionResult(w, r, http.StatusConflict, err.Error())
+	case errors.Is(err, upgrade.ErrInvalidImage), errors.Is(err, upgrade.ErrInvalidVersion):
+		writeActionResult(w, r, http.StatusBadRequest, err.Error())
+	case err != nil:
+		log.Printf("Error running upgrade %s: %v", action, err)
+		writeActionResult(w, r, http.StatusInternalServerError, "Failed: "+err.Error())
+	default:
+		// Refresh the progress section straight away rather than at the next poll
+		w.Header().Set("HX-Trigger", "upgrade-changed")
+		writeActionResult(w, r, http.StatusOK, done)
+	}
+}
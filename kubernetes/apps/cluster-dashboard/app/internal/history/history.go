@@ -0,0 +1,223 @@
+package history
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pi-cluster/cluster-dashboard/internal/metrics"
+)
+
+// ErrInvalidResolution is returned for a resolution the history does not keep
+var ErrInvalidResolution = errors.New("invalid resolution")
+
+// resolution is a bucket width and how many buckets of it are kept
+type resolution struct {
+	width    time.Duration
+	capacity int
+}
+
+// History keeps recent metric values in fixed-size ring buffers, downsampled
+// into buckets at each resolution. Memory use is bounded by the number of
+// series: every series holds the same number of buckets, and a series, e.g. of
+// a removed node, is dropped once all its buckets are past their retention.
+type History struct {
+	mu          sync.RWMutex
+	resolutions []resolution
+	series      map[seriesKey][]*ring // One ring per resolution, in the order of resolutions
+	recorded    map[seriesKey]bool    // Series the last Record added to
+}
+
+// seriesKey identifies a series: a metric on a node, or the cluster average when node is empty
+type seriesKey struct {
+	metric string
+	node   string
+}
+
+// New creates an empty history keeping 3 hours by minute, a day by 5 minutes
+// and the retention, at least a day, by hour
+func New(retention time.Duration) *History {
+	hours := max(int(retention/time.Hour), 24)
+	return &History{
+		resolutions: []resolution{
+			{width: time.Minute, capacity: 180},
+			{width: 5 * time.Minute, capacity: 288},
+			{width: time.Hour, capacity: hours},
+		},
+		series:   make(map[seriesKey][]*ring),
+		recorded: make(map[seriesKey]bool),
+	}
+}
+
+// Retention returns how far back a resolution is kept, or 0 for one that is not
+func (h *History) Retention(width time.Duration) time.Duration {
+	if index := h.index(width); index >= 0 {
+		return time.Duration(h.resolutions[index].capacity) * width
+	}
+	return 0
+}
+
+// Record adds the values of a collect. Sections that were not freshly
+// collected are skipped, so stale data is not recorded again under a new time.
+func (h *History) Record(m *metrics.ClusterMetrics) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	at := m.UpdatedAt
+	clear(h.recorded)
+	if m.Sections[metrics.SectionHardware].State == metrics.SectionFresh {
+		for _, node := range m.Hardware.NodeDetails {
+			// Zero usage means metrics-server had no reading, as on the dashboard
+			if node.CPUUsage > 0 {
+				h.add(seriesKey{metrics.HistoryCPU, node.Name}, at, node.CPUUsage)
+			}
+			if node.MemoryUsage > 0 {
+				h.add(seriesKey{metrics.HistoryMemory, node.Name}, at, node.MemoryUsage)
+			}
+			if node.TemperatureStatus == metrics.TemperatureOK {
+				h.add(seriesKey{metrics.HistoryTemperature, node.Name}, at, node.Temperature)
+			}
+		}
+	}
+	if m.Sections[metrics.SectionKubernetes].State == metrics.SectionFresh {
+		if m.Kubernetes.CPUUsagePercent > 0 {
+			h.add(seriesKey{metrics.HistoryCPU, ""}, at, m.Kubernetes.CPUUsagePercent)
+		}
+		if m.Kubernetes.MemoryUsagePercent > 0 {
+			h.add(seriesKey{metrics.HistoryMemory, ""}, at, m.Kubernetes.MemoryUsagePercent)
+		}
+	}
+	h.expire(at)
+}
+
+// expire drops the series whose newest bucket at every resolution is past
+// that resolution's retention. h.mu must be held.
+func (h *History) expire(now time.Time) {
+	for key, rings := range h.series {
+		expired := true
+		for i, r := range rings {
+			retention := time.Duration(h.resolutions[i].capacity) * h.resolutions[i].width
+			if last := r.last(); last != nil && !last.Time.Before(now.Add(-retention)) {
+				expired = false
+				break
+			}
+		}
+		if expired {
+			delete(h.series, key)
+		}
+	}
+}
+
+// Series returns a metric of a node, or the cluster average when node is
+// empty, at a resolution of 1m, 5m or 1h
+func (h *History) Series(metric, node string, width time.Duration) (*metrics.HistorySeries, error) {
+	index := h.index(width)
+	if index < 0 {
+		return nil, fmt.Errorf("%w: %s, expected 1m, 5m or 1h", ErrInvalidResolution, width)
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	rings, ok := h.series[seriesKey{metric, node}]
+	if !ok {
+		if node == "" {
+			return nil, fmt.Errorf("no %s history for the cluster: %w", metric, metrics.ErrNotFound)
+		}
+		return nil, fmt.Errorf("no %s history for node %s: %w", metric, node, metrics.ErrNotFound)
+	}
+	return &metrics.HistorySeries{
+		Metric:     metric,
+		Node:       node,
+		Resolution: shortDuration(width),
+		Points:     rings[index].ordered(),
+	}, nil
+}
+
+// Newest returns the newest bucket at every resolution of the series the last
+// Record changed, for saving elsewhere. Series it did not change are left out,
+// so buckets expired from the saved copy are not written back.
+func (h *History) Newest() []*metrics.HistorySeries {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	var newest []*metrics.HistorySeries
+	for key := range h.recorded {
+		rings, ok := h.series[key]
+		if !ok {
+			continue
+		}
+		for i, r := range rings {
+			if last := r.last(); last != nil {
+				newest = append(newest, &metrics.HistorySeries{
+					Metric:     key.metric,
+					Node:       key.node,
+					Resolution: shortDuration(h.resolutions[i].width),
+					Points:     []metrics.HistoryPoint{*last},
+				})
+			}
+		}
+	}
+	return newest
+}
+
+// Restore loads saved buckets, e.g. after a restart. Points of a series must
+// be oldest first; a bucket already held is replaced, and buckets beyond a
+// ring's capacity push out the oldest.
+func (h *History) Restore(series []*metrics.HistorySeries) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, s := range series {
+		width, err := time.ParseDuration(s.Resolution)
+		index := h.index(width)
+		if err != nil || index < 0 {
+			return fmt.Errorf("%w: %s", ErrInvalidResolution, s.Resolution)
+		}
+		rings := h.rings(seriesKey{s.Metric, s.Node})
+		for _, point := range s.Points {
+			rings[index].restore(point)
+		}
+	}
+	return nil
+}
+
+// add records one value into every resolution of a series. h.mu must be held.
+func (h *History) add(key seriesKey, at time.Time, value float64) {
+	for _, r := range h.rings(key) {
+		r.add(at, value)
+	}
+	h.recorded[key] = true
+}
+
+// index returns the position of a resolution in h.resolutions, or -1
+func (h *History) index(width time.Duration) int {
+	for i, res := range h.resolutions {
+		if res.width == width {
+			return i
+		}
+	}
+	return -1
+}
+
+// rings returns the rings of a series, creating them for a new one. h.mu must be held.
+func (h *History) rings(key seriesKey) []*ring {
+	rings, ok := h.series[key]
+	if !ok {
+		rings = make([]*ring, len(h.resolutions))
+		for i, res := range h.resolutions {
+			rings[i] = newRing(res)
+		}
+		h.series[key] = rings
+	}
+	return rings
+}
+
+// shortDuration formats 1m0s as 1m and 1h0m0s as 1h
+func shortDuration(d time.Duration) string {
+	if d%time.Hour == 0 {
+		return fmt.Sprintf("%dh", d/time.Hour)
+	}
+	return fmt.Sprintf("%dm", d/time.Minute)
+}
@@ -0,0 +1,86 @@
+package history
+
+import (
+	"time"
+
+	"github.com/pi-cluster/cluster-dashboard/internal/metrics"
+)
+
+// ring is a fixed-size buffer of buckets at one resolution. Once full, a new
+// bucket overwrites the oldest.
+type ring struct {
+	width  time.Duration
+	points []metrics.HistoryPoint // Grows to capacity, then wraps around
+	next   int                    // Where the next bucket goes once full
+}
+
+// newRing creates an empty ring for a resolution
+func newRing(res resolution) *ring {
+	return &ring{width: res.width, points: make([]metrics.HistoryPoint, 0, res.capacity)}
+}
+
+// add merges a value into the bucket it falls in, starting a new bucket when
+// it is past the newest one. Values older than the newest bucket are dropped.
+func (r *ring) add(at time.Time, value float64) {
+	start := at.Truncate(r.width)
+	if last := r.last(); last != nil {
+		switch {
+		case start.Equal(last.Time):
+			last.Avg += (value - last.Avg) / float64(last.Samples+1)
+			last.Min = min(last.Min, value)
+			last.Max = max(last.Max, value)
+			last.Samples++
+			return
+		case start.Before(last.Time):
+			return
+		}
+	}
+
+	r.push(metrics.HistoryPoint{Time: start, Avg: value, Min: value, Max: value, Samples: 1})
+}
+
+// push appends a bucket, overwriting the oldest once the ring is full
+func (r *ring) push(point metrics.HistoryPoint) {
+	if len(r.points) < cap(r.points) {
+		r.points = append(r.points, point)
+		return
+	}
+	r.points[r.next] = point
+	r.next = (r.next + 1) % len(r.points)
+}
+
+// last returns the newest bucket, or nil when the ring is empty
+func (r *ring) last() *metrics.HistoryPoint {
+	if len(r.points) == 0 {
+		return nil
+	}
+	if len(r.points) < cap(r.points) {
+		return &r.points[len(r.points)-1]
+	}
+	return &r.points[(r.next+len(r.points)-1)%len(r.points)]
+}
+
+// ordered returns a copy of the buckets, oldest first
+func (r *ring) ordered() []metrics.HistoryPoint {
+	points := make([]metrics.HistoryPoint, 0, len(r.points))
+	if len(r.points) < cap(r.points) {
+		return append(points, r.points...)
+	}
+	points = append(points, r.points[r.next:]...)
+	return append(points, r.points[:r.next]...)
+}
+
+// restore puts back a saved bucket: it replaces the newest bucket when it has
+// the same start and is dropped when older
+func (r *ring) restore(point metrics.HistoryPoint) {
+	if last := r.last(); last != nil {
+		switch {
+		case point.Time.Equal(last.Time):
+			*last = point
+			return
+		case point.Time.Before(last.Time):
+			return
+		}
+	}
+	r.push(point)
+}
@@ -2,26 +2,56 @@ package k8s
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/pi-cluster/cluster-dashboard/internal/metrics"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
-	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/discovery/cached/memory"
 	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/metadata"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/clientcmd"
 	metricsv "k8s.io/metrics/pkg/client/clientset/versioned"
 )
 
+// informerResync is how often the shared informers replay their cache.
+// Changes arrive through watches, so this is only a safety net.
+const informerResync = 10 * time.Minute
+
+// errCacheNotSynced is returned while the informer caches are still filling
+var errCacheNotSynced = errors.New("informer caches not synced yet")
+
 // Client implements the K8sClient interface
 type Client struct {
 	clientset        *kubernetes.Clientset
 	metricsClientset *metricsv.Clientset
 	dynamicClient    dynamic.Interface
+	metadataClient   metadata.Interface // Existence checks that do not read object data
+
+	// Maps inventory GroupKinds to resources using cached discovery
+	restMapper *restmapper.DeferredDiscoveryRESTMapper
+
+	// Shared informers watch the API server so reads come from a local cache
+	informerFactory   informers.SharedInformerFactory
+	nodeLister        corelisters.NodeLister
+	podLister         corelisters.PodLister
+	eventLister       corelisters.EventLister
+	deploymentLister  appslisters.DeploymentLister
+	daemonSetLister   appslisters.DaemonSetLister
+	statefulSetLister appslisters.StatefulSetLister
+	cacheSyncs        map[string]cache.InformerSynced
 }
 
 // NewClient creates a new Kubernetes client using in-cluster config or local kubeconfig
@@ -61,17 +91,92 @@ func NewClient() (*Client, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to create dynamic client: %w", err)
 	}
+	metadataClient, err := metadata.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create metadata client: %w", err)
+	}
+
+	// Managed fields are never read and make up a large share of every
+	// cached object, so drop them to keep memory low on the Pis
+	factory := informers.NewSharedInformerFactoryWithOptions(clientset, informerResync,
+		informers.WithTransform(stripManagedFields))
+
+	nodes := factory.Core().V1().Nodes()
+	pods := factory.Core().V1().Pods()
+	events := factory.Core().V1().Events()
+	deployments := factory.Apps().V1().Deployments()
+	daemonSets := factory.Apps().V1().DaemonSets()
+	statefulSets := factory.Apps().V1().StatefulSets()
 
 	return &Client{
-		clientset:        clientset,
-		metricsClientset: metricsClientset,
-		dynamicClient:    dynamicClient,
+		clientset:         clientset,
+		metricsClientset:  metricsClientset,
+		dynamicClient:     dynamicClient,
+		metadataClient:    metadataClient,
+		restMapper:        restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(clientset.Discovery())),
+		informerFactory:   factory,
+		nodeLister:        nodes.Lister(),
+		podLister:         pods.Lister(),
+		eventLister:       events.Lister(),
+		deploymentLister:  deployments.Lister(),
+		daemonSetLister:   daemonSets.Lister(),
+		statefulSetLister: statefulSets.Lister(),
+		cacheSyncs: map[string]cache.InformerSynced{
+			"nodes":        nodes.Informer().HasSynced,
+			"pods":         pods.Informer().HasSynced,
+			"events":       events.Informer().HasSynced,
+			"deployments":  deployments.Informer().HasSynced,
+			"daemonsets":   daemonSets.Informer().HasSynced,
+			"statefulsets": statefulSets.Informer().HasSynced,
+		},
 	}, nil
 }
 
+// Start begins watching the cluster. It returns immediately; the caches
+// fill in the background and stop when ctx is cancelled.
+func (c *Client) Start(ctx context.Context) {
+	c.informerFactory.Start(ctx.Done())
+
+	go func() {
+		<-ctx.Done()
+		c.informerFactory.Shutdown()
+	}()
+}
+
+// CacheSynced reports the sync state of each informer cache
+func (c *Client) CacheSynced() map[string]bool {
+	status := make(map[string]bool, len(c.cacheSyncs))
+	for name, synced := range c.cacheSyncs {
+		status[name] = synced()
+	}
+	return status
+}
+
+// hasSynced returns true once every informer cache has completed its initial list
+func (c *Client) hasSynced() bool {
+	for _, synced := range c.cacheSyncs {
+		if !synced() {
+			return false
+		}
+	}
+	return true
+}
+
+// stripManagedFields removes metadata.managedFields before objects enter the cache
+func stripManagedFields(obj interface{}) (interface{}, error) {
+	if accessor, err := meta.Accessor(obj); err == nil {
+		accessor.SetManagedFields(nil)
+	}
+	return obj, nil
+}
+
 // GetNodeMetrics retrieves node metrics and details
 func (c *Client) GetNodeMetrics(ctx context.Context) ([]metrics.NodeDetail, error) {
-	nodes, err := c.clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if !c.hasSynced() {
+		return nil, errCacheNotSynced
+	}
+
+	nodes, err := c.nodeLister.List(labels.Everything())
 	if err != nil {
 		return nil, fmt.Errorf("failed to list nodes: %w", err)
 	}
@@ -97,7 +202,7 @@ func (c *Client) GetNodeMetrics(ctx context.Context) ([]metrics.NodeDetail, erro
 				memory := metric.Usage.Memory().AsApproximateFloat64()
 
 				// Get capacity from node
-				for _, node := range nodes.Items {
+				for _, node := range nodes {
 					if node.Name == metric.Name {
 						cpuCapacity := node.Status.Capacity.Cpu().AsApproximateFloat64()
 						memCapacity := node.Status.Capacity.Memory().AsApproximateFloat64()
@@ -119,7 +224,7 @@ func (c *Client) GetNodeMetrics(ctx context.Context) ([]metrics.NodeDetail, erro
 		}
 	}
 
-	for _, node := range nodes.Items {
+	for _, node := range nodes {
 		// Determine node role
 		role := "worker"
 		if _, exists := node.Labels["node-role.kubernetes.io/control-plane"]; exists {
@@ -150,11 +255,14 @@ func (c *Client) GetNodeMetrics(ctx context.Context) ([]metrics.NodeDetail, erro
 		}
 
 		detail := metrics.NodeDetail{
-			Name:    node.Name,
-			IP:      nodeIP,
-			Role:    role,
-			Status:  status,
-			IsReady: isReady,
+			Name:     node.Name,
+			IP:       nodeIP,
+			Role:     role,
+			Status:   status,
+			IsReady:  isReady,
+			Cordoned: node.Spec.Unschedulable,
+
+			KubeletVersion: node.Status.NodeInfo.KubeletVersion,
 		}
 
 		// Add metrics if available
@@ -171,12 +279,16 @@ func (c *Client) GetNodeMetrics(ctx context.Context) ([]metrics.NodeDetail, erro
 
 // GetKubernetesStatus retrieves overall Kubernetes cluster status
 func (c *Client) GetKubernetesStatus(ctx context.Context) (*metrics.KubernetesStatus, error) {
+	if !c.hasSynced() {
+		return nil, errCacheNotSynced
+	}
+
 	version, err := c.clientset.Discovery().ServerVersion()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get server version: %w", err)
 	}
 
-	nodes, err := c.clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	nodes, err := c.nodeLister.List(labels.Everything())
 	if err != nil {
 		return nil, fmt.Errorf("failed to list nodes: %w", err)
 	}
@@ -186,7 +298,7 @@ func (c *Client) GetKubernetesStatus(ctx context.Context) (*metrics.KubernetesSt
 	workerReady := 0
 	workerTotal := 0
 
-	for _, node := range nodes.Items {
+	for _, node := range nodes {
 		isControlPlane := false
 		if _, exists := node.Labels["node-role.kubernetes.io/control-plane"]; exists {
 			isControlPlane = true
@@ -213,14 +325,14 @@ func (c *Client) GetKubernetesStatus(ctx context.Context) (*metrics.KubernetesSt
 	}
 
 	// Get pod statistics
-	pods, err := c.clientset.CoreV1().Pods("").List(ctx, metav1.ListOptions{})
+	pods, err := c.podLister.List(labels.Everything())
 	if err != nil {
 		return nil, fmt.Errorf("failed to list pods: %w", err)
 	}
 
 	runningPods := 0
 	failedPods := 0
-	for _, pod := range pods.Items {
+	for _, pod := range pods {
 		if pod.Status.Phase == corev1.PodRunning {
 			runningPods++
 		} else if pod.Status.Phase == corev1.PodFailed {
@@ -240,7 +352,7 @@ func (c *Client) GetKubernetesStatus(ctx context.Context) (*metrics.KubernetesSt
 				memory := metric.Usage.Memory().AsApproximateFloat64()
 
 				// Get capacity
-				for _, node := range nodes.Items {
+				for _, node := range nodes {
 					if node.Name == metric.Name {
 						cpuCapacity := node.Status.Capacity.Cpu().AsApproximateFloat64()
 						memCapacity := node.Status.Capacity.Memory().AsApproximateFloat64()
@@ -268,7 +380,7 @@ func (c *Client) GetKubernetesStatus(ctx context.Context) (*metrics.KubernetesSt
 		Version:            version.GitVersion,
 		ControlPlaneReady:  fmt.Sprintf("%d/%d", controlPlaneReady, controlPlaneTotal),
 		WorkerNodesReady:   fmt.Sprintf("%d/%d", workerReady, workerTotal),
-		TotalPods:          len(pods.Items),
+		TotalPods:          len(pods),
 		RunningPods:        runningPods,
 		FailedPods:         failedPods,
 		CPUUsagePercent:    avgCPU,
@@ -279,17 +391,19 @@ func (c *Client) GetKubernetesStatus(ctx context.Context) (*metrics.KubernetesSt
 
 // GetApplicationStatus retrieves status of applications with the dashboard.monitor label
 func (c *Client) GetApplicationStatus(ctx context.Context) ([]metrics.AppStatus, error) {
+	if !c.hasSynced() {
+		return nil, errCacheNotSynced
+	}
+
 	var appStatuses []metrics.AppStatus
 
 	// Label selector to find monitored applications
-	labelSelector := "dashboard.monitor=true"
+	labelSelector := labels.SelectorFromSet(labels.Set{"dashboard.monitor": "true"})
 
 	// Find all deployments with the monitoring label
-	deployments, err := c.clientset.AppsV1().Deployments("").List(ctx, metav1.ListOptions{
-		LabelSelector: labelSelector,
-	})
+	deployments, err := c.deploymentLister.List(labelSelector)
 	if err == nil {
-		for _, deployment := range deployments.Items {
+		for _, deployment := range deployments {
 			ready := deployment.Status.ReadyReplicas
 			desired := deployment.Status.Replicas
 			healthy := ready == desired && desired > 0
@@ -314,11 +428,9 @@ func (c *Client) GetApplicationStatus(ctx context.Context) ([]metrics.AppStatus,
 	}
 
 	// Find all daemonsets with the monitoring label
-	daemonsets, err := c.clientset.AppsV1().DaemonSets("").List(ctx, metav1.ListOptions{
-		LabelSelector: labelSelector,
-	})
+	daemonsets, err := c.daemonSetLister.List(labelSelector)
 	if err == nil {
-		for _, daemonset := range daemonsets.Items {
+		for _, daemonset := range daemonsets {
 			ready := daemonset.Status.NumberReady
 			desired := daemonset.Status.DesiredNumberScheduled
 			healthy := ready == desired && desired > 0
@@ -340,11 +452,9 @@ func (c *Client) GetApplicationStatus(ctx context.Context) ([]metrics.AppStatus,
 	}
 
 	// Find all statefulsets with the monitoring label
-	statefulsets, err := c.clientset.AppsV1().StatefulSets("").List(ctx, metav1.ListOptions{
-		LabelSelector: labelSelector,
-	})
+	statefulsets, err := c.statefulSetLister.List(labelSelector)
 	if err == nil {
-		for _, statefulset := range statefulsets.Items {
+		for _, statefulset := range statefulsets {
 			ready := statefulset.Status.ReadyReplicas
 			desired := int32(0)
 			if statefulset.Spec.Replicas != nil {
@@ -373,62 +483,51 @@ func (c *Client) GetApplicationStatus(ctx context.Context) ([]metrics.AppStatus,
 
 // GetFluxStatus retrieves Flux GitOps status
 func (c *Client) GetFluxStatus(ctx context.Context) (*metrics.FluxStatus, error) {
-	fluxNamespace := "flux-system"
+	if !c.hasSynced() {
+		return nil, errCacheNotSynced
+	}
 
-	// Get Flux version from deployment
-	fluxVersion := "v2.7.2"
+	fluxNamespace := "flux-system"
 
-	// Simplified status check - just verify Flux pods are running
-	pods, err := c.clientset.CoreV1().Pods(fluxNamespace).List(ctx, metav1.ListOptions{
-		LabelSelector: "app.kubernetes.io/part-of=flux",
-	})
+	// Work out the installed version from the controller Deployments
+	controllers := c.listFluxControllers(fluxNamespace)
+	fluxVersion, versionSkew := fluxDistributionVersion(controllers)
 
 	allHealthy := true
-	if err == nil {
-		for _, pod := range pods.Items {
-			if pod.Status.Phase != corev1.PodRunning {
-				allHealthy = false
-				break
-			}
+	for _, ctrl := range controllers {
+		if !ctrl.Ready {
+			allHealthy = false
+			break
+		}
+	}
+
+	// Query Kustomizations so a failing reconcile shows up as unhealthy
+	kustomizations, err := c.listKustomizations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Query sources; a repository that fails to fetch blocks everything built from it
+	sources := c.listSources(ctx)
+
+	// The cluster's own GitRepository drives the summary shown in the header
+	gitRepository := "N/A"
+	lastSync := "N/A"
+	for _, src := range sources {
+		if src.Kind != "GitRepository" {
+			continue
+		}
+		if gitRepository == "N/A" || (src.Namespace == fluxNamespace && src.Name == "flux-system") {
+			gitRepository = src.URL
+			lastSync = src.LastSync
 		}
-	} else {
-		allHealthy = false
-	}
-
-	// Hardcoded key resources (simpler than querying CRDs)
-	kustomizations := []metrics.FluxResource{
-		{
-			Name:      "flux-system",
-			Namespace: "flux-system",
-			Ready:     allHealthy,
-			Status:    "Ready",
-			Revision:  "main",
-		},
-		{
-			Name:      "infrastructure",
-			Namespace: "flux-system",
-			Ready:     allHealthy,
-			Status:    "Ready",
-			Revision:  "main",
-		},
-		{
-			Name:      "apps",
-			Namespace: "flux-system",
-			Ready:     allHealthy,
-			Status:    "Ready",
-			Revision:  "main",
-		},
 	}
 
 	// Query HelmReleases dynamically from Flux CRDs
 	helmReleases := []metrics.FluxResource{}
 
 	// Use dynamic client to query HelmRelease CRDs across all namespaces
-	helmReleaseList, err := c.dynamicClient.Resource(schema.GroupVersionResource{
-		Group:    "helm.toolkit.fluxcd.io",
-		Version:  "v2",
-		Resource: "helmreleases",
-	}).List(ctx, metav1.ListOptions{})
+	helmReleaseList, err := c.dynamicClient.Resource(helmReleaseGVR).List(ctx, metav1.ListOptions{})
 
 	if err == nil && helmReleaseList != nil {
 		for _, item := range helmReleaseList.Items {
@@ -454,6 +553,11 @@ func (c *Client) GetFluxStatus(ctx context.Context) (*metrics.FluxStatus, error)
 				}
 			}
 
+			suspended, _, _ := unstructured.NestedBool(item.Object, "spec", "suspend")
+			if suspended {
+				statusStr = "Suspended"
+			}
+
 			// Get chart version from spec
 			spec, _, _ := unstructured.NestedMap(item.Object, "spec")
 			chart, _, _ := unstructured.NestedMap(spec, "chart")
@@ -473,16 +577,29 @@ func (c *Client) GetFluxStatus(ctx context.Context) (*metrics.FluxStatus, error)
 				Ready:        ready,
 				Status:       statusStr,
 				Revision:     revision,
+				Suspended:    suspended,
 				ChartVersion: chartVersion,
 				Age:          age,
 			})
 		}
 	}
 
-	// Check overall health
+	// Check overall health; suspended Kustomizations are paused on purpose
 	healthy := allHealthy
+	for _, ks := range kustomizations {
+		if !ks.Ready && !ks.Suspended {
+			healthy = false
+			break
+		}
+	}
+	for _, src := range sources {
+		if !src.Ready && !src.Suspended {
+			healthy = false
+			break
+		}
+	}
 	for _, hr := range helmReleases {
-		if !hr.Ready {
+		if !hr.Ready && !hr.Suspended {
 			healthy = false
 			break
 		}
@@ -490,10 +607,14 @@ func (c *Client) GetFluxStatus(ctx context.Context) (*metrics.FluxStatus, error)
 
 	return &metrics.FluxStatus{
 		Version:        fluxVersion,
-		GitRepository:  "rjeans/automation",
-		LastSync:       "< 1 min ago",
+		VersionSkew:    versionSkew,
+		Controllers:    controllers,
+		GitRepository:  gitRepository,
+		LastSync:       lastSync,
+		Sources:        sources,
 		Kustomizations: kustomizations,
 		HelmReleases:   helmReleases,
+		RecentActivity: c.recentFluxEvents(),
 		Healthy:        healthy,
 	}, nil
 }
@@ -0,0 +1,56 @@
+package k8s
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/pi-cluster/cluster-dashboard/internal/metrics"
+)
+
+// WarningEvents returns the Warning events in the informer cache that last
+// occurred at or after since, oldest first
+func (c *Client) WarningEvents(since time.Time) ([]metrics.ClusterEvent, error) {
+	events, err := c.eventLister.List(labels.Everything())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list events: %w", err)
+	}
+
+	var warnings []metrics.ClusterEvent
+	for _, event := range events {
+		if event.Type != corev1.EventTypeWarning {
+			continue
+		}
+		// Events reported through events.k8s.io carry their repeats in the series
+		lastSeen, count := eventTime(event), event.Count
+		if event.Series != nil {
+			lastSeen, count = event.Series.LastObservedTime.Time, event.Series.Count
+		}
+		if lastSeen.Before(since) {
+			continue
+		}
+		firstSeen := event.FirstTimestamp.Time
+		if firstSeen.IsZero() {
+			firstSeen = eventTime(event)
+		}
+		warnings = append(warnings, metrics.ClusterEvent{
+			UID:       string(event.UID),
+			FirstSeen: firstSeen,
+			LastSeen:  lastSeen,
+			Count:     max(count, 1),
+			Namespace: event.Namespace,
+			Object:    event.InvolvedObject.Kind + "/" + event.InvolvedObject.Name,
+			Reason:    event.Reason,
+			Message:   strings.TrimSpace(event.Message),
+		})
+	}
+
+	sort.Slice(warnings, func(i, j int) bool {
+		return warnings[i].LastSeen.Before(warnings[j].LastSeen)
+	})
+	return warnings, nil
+}
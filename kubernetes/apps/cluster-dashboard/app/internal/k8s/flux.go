@@ -0,0 +1,555 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pi-cluster/cluster-dashboard/internal/metrics"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Flux custom resources queried through the dynamic client
+var (
+	kustomizationGVR = schema.GroupVersionResource{
+		Group:    "kustomize.toolkit.fluxcd.io",
+		Version:  "v1",
+		Resource: "kustomizations",
+	}
+	helmReleaseGVR = schema.GroupVersionResource{
+		Group:    "helm.toolkit.fluxcd.io",
+		Version:  "v2",
+		Resource: "helmreleases",
+	}
+)
+
+// fluxSourceKinds lists the source-controller kinds in display order
+var fluxSourceKinds = []struct {
+	Kind string
+	GVR  schema.GroupVersionResource
+}{
+	{"GitRepository", schema.GroupVersionResource{Group: "source.toolkit.fluxcd.io", Version: "v1", Resource: "gitrepositories"}},
+	{"HelmRepository", schema.GroupVersionResource{Group: "source.toolkit.fluxcd.io", Version: "v1", Resource: "helmrepositories"}},
+	{"OCIRepository", schema.GroupVersionResource{Group: "source.toolkit.fluxcd.io", Version: "v1", Resource: "ocirepositories"}},
+	{"HelmChart", schema.GroupVersionResource{Group: "source.toolkit.fluxcd.io", Version: "v1", Resource: "helmcharts"}},
+}
+
+// fluxControllers are the controllers every Flux install is expected to run
+var fluxControllers = []string{
+	"source-controller",
+	"kustomize-controller",
+	"helm-controller",
+	"notification-controller",
+}
+
+// fluxReleaseOffsets is how far each controller's minor version trails the Flux
+// release it ships in: Flux v2.7 installs source-controller v1.7 and helm-controller v1.4
+var fluxReleaseOffsets = map[string]int{
+	"source-controller":       0,
+	"kustomize-controller":    0,
+	"helm-controller":         3,
+	"notification-controller": 0,
+}
+
+// fluxEventKinds are the involvedObject kinds whose events make up the activity feed
+var fluxEventKinds = map[string]bool{
+	"Kustomization":  true,
+	"HelmRelease":    true,
+	"GitRepository":  true,
+	"HelmRepository": true,
+	"OCIRepository":  true,
+	"HelmChart":      true,
+}
+
+// maxFluxEvents is how many events the activity feed keeps
+const maxFluxEvents = 20
+
+// fluxCondition is the subset of a status condition the dashboard displays
+type fluxCondition struct {
+	Status             string
+	Reason             string
+	Message            string
+	LastTransitionTime time.Time
+}
+
+// findCondition returns the condition of the given type from status.conditions
+func findCondition(obj map[string]interface{}, condType string) (fluxCondition, bool) {
+	conditions, _, _ := unstructured.NestedSlice(obj, "status", "conditions")
+	for _, cond := range conditions {
+		condMap, ok := cond.(map[string]interface{})
+		if !ok || condMap["type"] != condType {
+			continue
+		}
+		status, _, _ := unstructured.NestedString(condMap, "status")
+		reason, _, _ := unstructured.NestedString(condMap, "reason")
+		message, _, _ := unstructured.NestedString(condMap, "message")
+		return fluxCondition{
+			Status:             status,
+			Reason:             reason,
+			Message:            message,
+			LastTransitionTime: nestedTime(condMap, "lastTransitionTime"),
+		}, true
+	}
+	return fluxCondition{}, false
+}
+
+// nestedTime parses an RFC3339 timestamp field, returning the zero time if absent
+func nestedTime(obj map[string]interface{}, fields ...string) time.Time {
+	value, _, _ := unstructured.NestedString(obj, fields...)
+	t, _ := time.Parse(time.RFC3339, value)
+	return t
+}
+
+// listKustomizations reads every Flux Kustomization and its reconcile state
+func (c *Client) listKustomizations(ctx context.Context) ([]metrics.FluxResource, error) {
+	list, err := c.dynamicClient.Resource(kustomizationGVR).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list kustomizations: %w", err)
+	}
+
+	kustomizations := []metrics.FluxResource{}
+	for _, item := range list.Items {
+		suspended, _, _ := unstructured.NestedBool(item.Object, "spec", "suspend")
+		applied, _, _ := unstructured.NestedString(item.Object, "status", "lastAppliedRevision")
+		attempted, _, _ := unstructured.NestedString(item.Object, "status", "lastAttemptedRevision")
+
+		// dependsOn entries may omit the namespace when it matches the Kustomization's own
+		var dependsOn []string
+		deps, _, _ := unstructured.NestedSlice(item.Object, "spec", "dependsOn")
+		for _, dep := range deps {
+			depMap, ok := dep.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			name, _, _ := unstructured.NestedString(depMap, "name")
+			if namespace, _, _ := unstructured.NestedString(depMap, "namespace"); namespace != "" {
+				name = namespace + "/" + name
+			}
+			dependsOn = append(dependsOn, name)
+		}
+
+		ready := false
+		statusStr := "Unknown"
+		cond, found := findCondition(item.Object, "Ready")
+		if found {
+			switch cond.Status {
+			case "True":
+				ready = true
+				statusStr = "Ready"
+			case "False":
+				statusStr = "Not Ready"
+			default:
+				statusStr = "Reconciling"
+			}
+		}
+		if suspended {
+			statusStr = "Suspended"
+		}
+
+		creationTime := item.GetCreationTimestamp()
+
+		kustomizations = append(kustomizations, metrics.FluxResource{
+			Name:                  item.GetName(),
+			Namespace:             item.GetNamespace(),
+			Ready:                 ready,
+			Status:                statusStr,
+			Reason:                cond.Reason,
+			Message:               cond.Message,
+			Revision:              applied,
+			LastAppliedRevision:   applied,
+			LastAttemptedRevision: attempted,
+			Suspended:             suspended,
+			DependsOn:             dependsOn,
+			Age:                   formatTimeAgo(time.Since(creationTime.Time)),
+		})
+	}
+
+	return kustomizations, nil
+}
+
+// listSources reads every Flux source and the state of its last fetched artifact.
+// Kinds that cannot be listed (e.g. CRD not installed) are skipped.
+func (c *Client) listSources(ctx context.Context) []metrics.FluxSource {
+	sources := []metrics.FluxSource{}
+
+	for _, sk := range fluxSourceKinds {
+		list, err := c.dynamicClient.Resource(sk.GVR).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			continue
+		}
+
+		for _, item := range list.Items {
+			suspended, _, _ := unstructured.NestedBool(item.Object, "spec", "suspend")
+			revision, _, _ := unstructured.NestedString(item.Object, "status", "artifact", "revision")
+
+			// HelmCharts have no URL of their own; show the chart and where it comes from
+			url, _, _ := unstructured.NestedString(item.Object, "spec", "url")
+			if sk.Kind == "HelmChart" {
+				chart, _, _ := unstructured.NestedString(item.Object, "spec", "chart")
+				refKind, _, _ := unstructured.NestedString(item.Object, "spec", "sourceRef", "kind")
+				refName, _, _ := unstructured.NestedString(item.Object, "spec", "sourceRef", "name")
+				url = fmt.Sprintf("%s from %s/%s", chart, refKind, refName)
+			}
+
+			source := metrics.FluxSource{
+				Kind:      sk.Kind,
+				Name:      item.GetName(),
+				Namespace: item.GetNamespace(),
+				URL:       url,
+				Revision:  revision,
+				LastSync:  "Never",
+				Status:    "Unknown",
+				Suspended: suspended,
+			}
+
+			updated, _, _ := unstructured.NestedString(item.Object, "status", "artifact", "lastUpdateTime")
+			if t, err := time.Parse(time.RFC3339, updated); err == nil {
+				source.LastFetched = t
+				source.LastSync = formatTimeAgo(time.Since(t))
+			}
+
+			cond, found := findCondition(item.Object, "Ready")
+			switch {
+			case found && cond.Status == "True":
+				source.Ready = true
+				source.Status = "Ready"
+			case found && cond.Status == "False":
+				source.Status = "Fetch Failed"
+			case found:
+				source.Status = "Reconciling"
+			default:
+				// OCI HelmRepositories are static and never report conditions
+				repoType, _, _ := unstructured.NestedString(item.Object, "spec", "type")
+				if sk.Kind == "HelmRepository" && repoType == "oci" {
+					source.Ready = true
+					source.Status = "Static"
+				}
+			}
+			source.Reason = cond.Reason
+			source.Message = cond.Message
+			if suspended {
+				source.Status = "Suspended"
+			}
+
+			sources = append(sources, source)
+		}
+	}
+
+	return sources
+}
+
+// listFluxControllers reads the Flux controller Deployments from the informer cache.
+// Expected controllers that are not deployed are reported as missing.
+func (c *Client) listFluxControllers(namespace string) []metrics.FluxController {
+	deployments, _ := c.deploymentLister.Deployments(namespace).List(labels.SelectorFromSet(labels.Set{
+		"app.kubernetes.io/part-of": "flux",
+	}))
+
+	found := make(map[string]bool)
+	controllers := []metrics.FluxController{}
+	for _, deployment := range deployments {
+		image := ""
+		for _, container := range deployment.Spec.Template.Spec.Containers {
+			if container.Name == "manager" || image == "" {
+				image = container.Image
+			}
+		}
+
+		desired := int32(1)
+		if deployment.Spec.Replicas != nil {
+			desired = *deployment.Spec.Replicas
+		}
+		ready := deployment.Status.ReadyReplicas
+		isReady := ready == desired && desired > 0
+
+		status := "Ready"
+		if desired == 0 {
+			status = "Scaled to Zero"
+		} else if !isReady {
+			status = "Not Ready"
+		}
+
+		found[deployment.Name] = true
+		controllers = append(controllers, metrics.FluxController{
+			Name:                deployment.Name,
+			Image:               image,
+			Version:             imageTag(image),
+			Release:             imageFluxRelease(deployment.Name, imageTag(image)),
+			DistributionVersion: deployment.Labels["app.kubernetes.io/version"],
+			ReadyReplicas:       fmt.Sprintf("%d/%d", ready, desired),
+			Ready:               isReady,
+			Status:              status,
+		})
+	}
+
+	for _, name := range fluxControllers {
+		if !found[name] {
+			controllers = append(controllers, metrics.FluxController{
+				Name:   name,
+				Status: "Missing",
+			})
+		}
+	}
+
+	sort.Slice(controllers, func(i, j int) bool {
+		return controllers[i].Name < controllers[j].Name
+	})
+
+	return controllers
+}
+
+// fluxDistributionVersion returns the Flux version the controllers were installed
+// from and whether they disagree, as happens after a partial gotk-components upgrade.
+// The version labels are checked first, then the release line of each controller
+// image, which also catches images patched without updating the labels.
+func fluxDistributionVersion(controllers []metrics.FluxController) (string, bool) {
+	versions := make(map[string]bool)
+	releases := make(map[string]bool)
+	for _, ctrl := range controllers {
+		if ctrl.DistributionVersion != "" {
+			versions[ctrl.DistributionVersion] = true
+		}
+		if ctrl.Release != "" {
+			releases[ctrl.Release] = true
+		}
+	}
+
+	if len(versions) > 1 {
+		return strings.Join(sortedKeys(versions), ", "), true
+	}
+	if len(releases) > 1 {
+		return strings.Join(sortedKeys(releases), ", ") + " (from controller images)", true
+	}
+
+	var release string
+	for r := range releases {
+		release = r
+	}
+	for version := range versions {
+		// The labels agree; the images must be from the same release line
+		return version, release != "" && !strings.HasPrefix(version, release+".")
+	}
+
+	// No version labels; fall back to the controller images
+	if release != "" {
+		return release + ".x (from controller images)", false
+	}
+	for _, ctrl := range controllers {
+		if ctrl.Name == "source-controller" && ctrl.Version != "" {
+			return "source-controller " + ctrl.Version, false
+		}
+	}
+	return "Unknown", false
+}
+
+// imageFluxRelease returns the Flux release line ("v2.7") a controller image tag
+// belongs to, or "" for unknown controllers and tags that are not v1.N.x
+func imageFluxRelease(name, tag string) string {
+	offset, ok := fluxReleaseOffsets[name]
+	if !ok {
+		return ""
+	}
+	var major, minor int
+	if _, err := fmt.Sscanf(tag, "v%d.%d", &major, &minor); err != nil || major != 1 {
+		return ""
+	}
+	return fmt.Sprintf("v2.%d", minor+offset)
+}
+
+// sortedKeys returns the keys of set in order
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// imageTag extracts the tag from an image reference, ignoring any digest
+func imageTag(image string) string {
+	if image == "" {
+		return ""
+	}
+	if i := strings.Index(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		return image[i+1:]
+	}
+	return "latest"
+}
+
+// recentFluxEvents returns the newest events about Flux objects from the informer cache
+func (c *Client) recentFluxEvents() []metrics.FluxEvent {
+	events, err := c.eventLister.List(labels.Everything())
+	if err != nil {
+		return []metrics.FluxEvent{}
+	}
+
+	var fluxEvents []*corev1.Event
+	for _, event := range events {
+		obj := event.InvolvedObject
+		if fluxEventKinds[obj.Kind] && strings.Contains(obj.APIVersion, "toolkit.fluxcd.io") {
+			fluxEvents = append(fluxEvents, event)
+		}
+	}
+
+	sort.Slice(fluxEvents, func(i, j int) bool {
+		return eventTime(fluxEvents[i]).After(eventTime(fluxEvents[j]))
+	})
+	if len(fluxEvents) > maxFluxEvents {
+		fluxEvents = fluxEvents[:maxFluxEvents]
+	}
+
+	activity := make([]metrics.FluxEvent, 0, len(fluxEvents))
+	for _, event := range fluxEvents {
+		obj := event.InvolvedObject
+		activity = append(activity, metrics.FluxEvent{
+			Time:     formatTimeAgo(time.Since(eventTime(event))),
+			Type:     event.Type,
+			Resource: fmt.Sprintf("%s/%s/%s", obj.Kind, obj.Namespace, obj.Name),
+			Reason:   event.Reason,
+			Message:  strings.TrimSpace(event.Message),
+		})
+	}
+
+	return activity
+}
+
+// eventTime returns when an event last occurred, whichever API field carries it
+func eventTime(event *corev1.Event) time.Time {
+	switch {
+	case !event.LastTimestamp.IsZero():
+		return event.LastTimestamp.Time
+	case !event.EventTime.IsZero():
+		return event.EventTime.Time
+	case !event.FirstTimestamp.IsZero():
+		return event.FirstTimestamp.Time
+	}
+	return event.CreationTimestamp.Time
+}
+
+// fluxResourceGVR maps the kind used in dashboard URLs to its Flux resource
+func fluxResourceGVR(kind string) (schema.GroupVersionResource, error) {
+	switch kind {
+	case "kustomizations":
+		return kustomizationGVR, nil
+	case "helmreleases":
+		return helmReleaseGVR, nil
+	}
+	return schema.GroupVersionResource{}, fmt.Errorf("unsupported flux kind %q", kind)
+}
+
+// sourceGVR maps a source kind as written in a sourceRef to its resource
+func sourceGVR(kind string) (schema.GroupVersionResource, error) {
+	for _, sk := range fluxSourceKinds {
+		if sk.Kind == kind {
+			return sk.GVR, nil
+		}
+	}
+	return schema.GroupVersionResource{}, fmt.Errorf("unsupported source kind %q", kind)
+}
+
+// requestReconcile sets the annotation Flux controllers watch to trigger an
+// out-of-band reconcile, the same thing `flux reconcile` does
+func (c *Client) requestReconcile(ctx context.Context, gvr schema.GroupVersionResource, namespace, name string) error {
+	patch := fmt.Sprintf(`{"metadata":{"annotations":{"reconcile.fluxcd.io/requestedAt":%q}}}`,
+		time.Now().Format(time.RFC3339Nano))
+
+	_, err := c.dynamicClient.Resource(gvr).Namespace(namespace).Patch(ctx, name, types.MergePatchType, []byte(patch), metav1.PatchOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to annotate %s %s/%s: %w", gvr.Resource, namespace, name, err)
+	}
+	return nil
+}
+
+// ReconcileFlux requests a reconcile of a Kustomization or HelmRelease. With
+// withSource the source it is built from is reconciled first, like
+// `flux reconcile ... --with-source`.
+func (c *Client) ReconcileFlux(ctx context.Context, kind, namespace, name string, withSource bool) error {
+	gvr, err := fluxResourceGVR(kind)
+	if err != nil {
+		return err
+	}
+
+	if withSource {
+		obj, err := c.dynamicClient.Resource(gvr).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to get %s %s/%s: %w", kind, namespace, name, err)
+		}
+
+		srcKind, srcNamespace, srcName := fluxSourceRef(obj)
+		if srcName == "" {
+			return fmt.Errorf("%s %s/%s has no source reference", kind, namespace, name)
+		}
+		srcGVR, err := sourceGVR(srcKind)
+		if err != nil {
+			return err
+		}
+		if err := c.requestReconcile(ctx, srcGVR, srcNamespace, srcName); err != nil {
+			return err
+		}
+	}
+
+	return c.requestReconcile(ctx, gvr, namespace, name)
+}
+
+// SuspendFlux sets spec.suspend on a Kustomization or HelmRelease. Resuming
+// also requests a reconcile so the object catches up straight away.
+func (c *Client) SuspendFlux(ctx context.Context, kind, namespace, name string, suspend bool) error {
+	gvr, err := fluxResourceGVR(kind)
+	if err != nil {
+		return err
+	}
+
+	patch := fmt.Sprintf(`{"spec":{"suspend":%t}}`, suspend)
+	_, err = c.dynamicClient.Resource(gvr).Namespace(namespace).Patch(ctx, name, types.MergePatchType, []byte(patch), metav1.PatchOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to set suspend=%t on %s %s/%s: %w", suspend, kind, namespace, name, err)
+	}
+
+	if !suspend {
+		return c.requestReconcile(ctx, gvr, namespace, name)
+	}
+	return nil
+}
+
+// fluxSourceRef returns the source a Kustomization or HelmRelease is built from.
+// HelmReleases using spec.chart reconcile through the HelmChart that
+// helm-controller generates, recorded in status.helmChart as namespace/name.
+func fluxSourceRef(obj *unstructured.Unstructured) (kind, namespace, name string) {
+	if obj.GetKind() == "HelmRelease" {
+		if chartRef, found, _ := unstructured.NestedMap(obj.Object, "spec", "chartRef"); found {
+			kind, _, _ = unstructured.NestedString(chartRef, "kind")
+			name, _, _ = unstructured.NestedString(chartRef, "name")
+			namespace, _, _ = unstructured.NestedString(chartRef, "namespace")
+		} else {
+			kind = "HelmChart"
+			helmChart, _, _ := unstructured.NestedString(obj.Object, "status", "helmChart")
+			if ns, n, ok := strings.Cut(helmChart, "/"); ok {
+				namespace, name = ns, n
+			} else {
+				// Not reconciled yet; fall back to helm-controller's naming scheme
+				namespace, _, _ = unstructured.NestedString(obj.Object, "spec", "chart", "spec", "sourceRef", "namespace")
+				name = obj.GetNamespace() + "-" + obj.GetName()
+			}
+		}
+	} else {
+		kind, _, _ = unstructured.NestedString(obj.Object, "spec", "sourceRef", "kind")
+		name, _, _ = unstructured.NestedString(obj.Object, "spec", "sourceRef", "name")
+		namespace, _, _ = unstructured.NestedString(obj.Object, "spec", "sourceRef", "namespace")
+	}
+
+	if namespace == "" {
+		namespace = obj.GetNamespace()
+	}
+	return kind, namespace, name
+}
@@ -0,0 +1,226 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pi-cluster/cluster-dashboard/internal/metrics"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+// redactedValue stands in for a targetPath value that comes from a Secret,
+// which the dashboard never reads
+const redactedValue = "**redacted**"
+
+// helmReleaseConditions are the conditions shown on the detail page, in display order
+var helmReleaseConditions = []string{"Ready", "Released", "TestSuccess", "Remediated"}
+
+// GetHelmReleaseDetail retrieves a HelmRelease with its history and effective values
+func (c *Client) GetHelmReleaseDetail(ctx context.Context, namespace, name string) (*metrics.HelmReleaseDetail, error) {
+	hr, err := c.dynamicClient.Resource(helmReleaseGVR).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("helmrelease %s/%s: %w", namespace, name, metrics.ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get helmrelease %s/%s: %w", namespace, name, err)
+	}
+
+	detail := &metrics.HelmReleaseDetail{
+		Name:       name,
+		Namespace:  namespace,
+		Conditions: []metrics.Condition{},
+		History:    []metrics.HelmReleaseSnapshot{},
+	}
+
+	detail.Chart, _, _ = unstructured.NestedString(hr.Object, "spec", "chart", "spec", "chart")
+	detail.ChartVersion, _, _ = unstructured.NestedString(hr.Object, "spec", "chart", "spec", "version")
+	detail.Suspended, _, _ = unstructured.NestedBool(hr.Object, "spec", "suspend")
+	detail.LastAttemptedRevision, _, _ = unstructured.NestedString(hr.Object, "status", "lastAttemptedRevision")
+	detail.InstallFailures, _, _ = unstructured.NestedInt64(hr.Object, "status", "installFailures")
+	detail.UpgradeFailures, _, _ = unstructured.NestedInt64(hr.Object, "status", "upgradeFailures")
+	detail.Failures, _, _ = unstructured.NestedInt64(hr.Object, "status", "failures")
+
+	srcKind, srcNamespace, srcName := fluxSourceRef(hr)
+	if _, found, _ := unstructured.NestedMap(hr.Object, "spec", "chartRef"); !found {
+		// Show the repository the chart is pulled from rather than the generated HelmChart
+		srcKind, _, _ = unstructured.NestedString(hr.Object, "spec", "chart", "spec", "sourceRef", "kind")
+		srcName, _, _ = unstructured.NestedString(hr.Object, "spec", "chart", "spec", "sourceRef", "name")
+	}
+	detail.Source = fmt.Sprintf("%s/%s/%s", srcKind, srcNamespace, srcName)
+
+	for _, condType := range helmReleaseConditions {
+		if cond, found := findConditionDetail(hr.Object, condType); found {
+			detail.Conditions = append(detail.Conditions, cond)
+		}
+	}
+
+	history, _, _ := unstructured.NestedSlice(hr.Object, "status", "history")
+	for _, entry := range history {
+		snapshot, ok := entry.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		detail.History = append(detail.History, parseSnapshot(snapshot))
+	}
+
+	c.mergeHelmReleaseValues(ctx, hr, detail)
+
+	return detail, nil
+}
+
+// findConditionDetail returns a condition in the form shown on detail pages
+func findConditionDetail(obj map[string]interface{}, condType string) (metrics.Condition, bool) {
+	cond, found := findCondition(obj, condType)
+	if !found {
+		return metrics.Condition{}, false
+	}
+	return metrics.Condition{
+		Type:               condType,
+		Status:             cond.Status,
+		Reason:             cond.Reason,
+		Message:            cond.Message,
+		LastTransitionTime: cond.LastTransitionTime,
+	}, true
+}
+
+// parseSnapshot converts a status.history entry
+func parseSnapshot(snapshot map[string]interface{}) metrics.HelmReleaseSnapshot {
+	s := metrics.HelmReleaseSnapshot{
+		FirstDeployed: nestedTime(snapshot, "firstDeployed"),
+		LastDeployed:  nestedTime(snapshot, "lastDeployed"),
+	}
+	s.Version, _, _ = unstructured.NestedInt64(snapshot, "version")
+	s.Status, _, _ = unstructured.NestedString(snapshot, "status")
+	s.ChartName, _, _ = unstructured.NestedString(snapshot, "chartName")
+	s.ChartVersion, _, _ = unstructured.NestedString(snapshot, "chartVersion")
+	s.AppVersion, _, _ = unstructured.NestedString(snapshot, "appVersion")
+	s.Digest, _, _ = unstructured.NestedString(snapshot, "digest")
+	s.ConfigDigest, _, _ = unstructured.NestedString(snapshot, "configDigest")
+	return s
+}
+
+// mergeHelmReleaseValues computes the values helm-controller passes to Helm:
+// each valuesFrom entry merged in order, then spec.values on top. Secrets are
+// only listed: a targetPath is shown redacted and a whole values file is left
+// out and recorded in ValuesIncomplete, so Secret data is never fetched.
+func (c *Client) mergeHelmReleaseValues(ctx context.Context, hr *unstructured.Unstructured, detail *metrics.HelmReleaseDetail) {
+	values := map[string]interface{}{}
+
+	refs, _, _ := unstructured.NestedSlice(hr.Object, "spec", "valuesFrom")
+	for _, ref := range refs {
+		refMap, ok := ref.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		kind, _, _ := unstructured.NestedString(refMap, "kind")
+		name, _, _ := unstructured.NestedString(refMap, "name")
+		valuesKey, _, _ := unstructured.NestedString(refMap, "valuesKey")
+		targetPath, _, _ := unstructured.NestedString(refMap, "targetPath")
+		optional, _, _ := unstructured.NestedBool(refMap, "optional")
+		if valuesKey == "" {
+			valuesKey = "values.yaml"
+		}
+
+		desc := fmt.Sprintf("%s/%s key %s", kind, name, valuesKey)
+		if targetPath != "" {
+			desc += " -> " + targetPath
+		}
+		if kind == "Secret" {
+			if targetPath != "" {
+				setPath(values, targetPath, redactedValue)
+			} else {
+				desc += " (not shown)"
+				detail.ValuesIncomplete = append(detail.ValuesIncomplete, fmt.Sprintf("%s/%s key %s", kind, name, valuesKey))
+			}
+		}
+		detail.ValuesFrom = append(detail.ValuesFrom, desc)
+		if kind == "Secret" {
+			continue
+		}
+
+		raw, found, err := c.readValuesKey(ctx, kind, hr.GetNamespace(), name, valuesKey)
+		if err != nil || !found {
+			if !optional {
+				if err == nil {
+					err = fmt.Errorf("key %s not found", valuesKey)
+				}
+				detail.ValuesErrors = append(detail.ValuesErrors, fmt.Sprintf("%s: %v", desc, err))
+			}
+			continue
+		}
+
+		if targetPath != "" {
+			setPath(values, targetPath, raw)
+			continue
+		}
+
+		parsed := map[string]interface{}{}
+		if err := yaml.Unmarshal([]byte(raw), &parsed); err != nil {
+			detail.ValuesErrors = append(detail.ValuesErrors, fmt.Sprintf("%s: invalid YAML: %v", desc, err))
+			continue
+		}
+		values = mergeValues(values, parsed)
+	}
+
+	if inline, found, _ := unstructured.NestedMap(hr.Object, "spec", "values"); found {
+		detail.ValuesFrom = append(detail.ValuesFrom, "spec.values")
+		values = mergeValues(values, inline)
+	}
+
+	out, err := yaml.Marshal(values)
+	if err != nil {
+		detail.ValuesErrors = append(detail.ValuesErrors, fmt.Sprintf("failed to render values: %v", err))
+		return
+	}
+	detail.Values = string(out)
+}
+
+// readValuesKey reads one key of a ConfigMap referenced by valuesFrom
+func (c *Client) readValuesKey(ctx context.Context, kind, namespace, name, key string) (string, bool, error) {
+	if kind != "ConfigMap" {
+		return "", false, fmt.Errorf("unsupported valuesFrom kind %q", kind)
+	}
+	cm, err := c.clientset.CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return "", false, err
+	}
+	value, found := cm.Data[key]
+	return value, found, nil
+}
+
+// mergeValues deep-merges override into base the way Helm merges values files
+func mergeValues(base, override map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(base))
+	for k, v := range base {
+		out[k] = v
+	}
+	for k, v := range override {
+		if overrideMap, ok := v.(map[string]interface{}); ok {
+			if baseMap, ok := out[k].(map[string]interface{}); ok {
+				out[k] = mergeValues(baseMap, overrideMap)
+				continue
+			}
+		}
+		out[k] = v
+	}
+	return out
+}
+
+// setPath sets a dot-separated targetPath, creating intermediate maps
+func setPath(values map[string]interface{}, path string, value interface{}) {
+	parts := strings.Split(path, ".")
+	current := values
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := current[part].(map[string]interface{})
+		if !ok {
+			next = map[string]interface{}{}
+			current[part] = next
+		}
+		current = next
+	}
+	current[parts[len(parts)-1]] = value
+}
@@ -0,0 +1,319 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pi-cluster/cluster-dashboard/internal/metrics"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// inventoryWorkers bounds concurrent GETs while resolving an inventory so a
+// large Kustomization does not flood the API server on the Pis
+const inventoryWorkers = 8
+
+// unparsedKind groups inventory entries whose id could not be parsed
+const unparsedKind = "(unrecognised id)"
+
+// Inventory object health states
+const (
+	healthHealthy     = "Healthy"
+	healthProgressing = "Progressing"
+	healthUnhealthy   = "Unhealthy"
+	healthMissing     = "Missing"
+	healthUnknown     = "Unknown"
+)
+
+// GetKustomizationInventory resolves a Kustomization's status.inventory into live objects
+func (c *Client) GetKustomizationInventory(ctx context.Context, namespace, name string) (*metrics.KustomizationInventory, error) {
+	ks, err := c.dynamicClient.Resource(kustomizationGVR).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("kustomization %s/%s: %w", namespace, name, metrics.ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get kustomization %s/%s: %w", namespace, name, err)
+	}
+
+	inventory := &metrics.KustomizationInventory{
+		Name:       name,
+		Namespace:  namespace,
+		Status:     "Unknown",
+		Namespaces: []metrics.InventoryNamespace{},
+	}
+	inventory.Revision, _, _ = unstructured.NestedString(ks.Object, "status", "lastAppliedRevision")
+	if cond, found := findCondition(ks.Object, "Ready"); found {
+		inventory.Ready = cond.Status == "True"
+		inventory.Status = cond.Reason
+	}
+
+	entries, _, _ := unstructured.NestedSlice(ks.Object, "status", "inventory", "entries")
+	objects := make([]metrics.InventoryObject, 0, len(entries))
+	for _, entry := range entries {
+		entryMap, ok := entry.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		id, _, _ := unstructured.NestedString(entryMap, "id")
+		version, _, _ := unstructured.NestedString(entryMap, "v")
+		obj, ok := parseInventoryID(id, version)
+		if !ok {
+			// Kept, so the totals match the inventory
+			obj = metrics.InventoryObject{Name: id, Kind: unparsedKind, Health: healthUnknown, Message: "unrecognised inventory id"}
+		}
+		objects = append(objects, obj)
+	}
+
+	// Resolve live health with a bounded pool of workers
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, inventoryWorkers)
+	for i := range objects {
+		if objects[i].Kind == unparsedKind {
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(obj *metrics.InventoryObject) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			obj.Health, obj.Message = c.inventoryObjectHealth(ctx, obj)
+		}(&objects[i])
+	}
+	wg.Wait()
+
+	for _, obj := range objects {
+		inventory.Total++
+		switch obj.Health {
+		case healthHealthy:
+			inventory.Healthy++
+		case healthMissing:
+			inventory.Missing++
+		case healthUnhealthy:
+			inventory.Unhealthy++
+		case healthUnknown:
+			inventory.Unknown++
+		}
+	}
+	inventory.Namespaces = groupInventory(objects)
+
+	return inventory, nil
+}
+
+// parseInventoryID splits an inventory id of the form <namespace>_<name>_<group>_<kind>.
+// Namespaces, groups and kinds cannot contain an underscore, but Flux writes a
+// colon in a name (system: ClusterRoles and their bindings) as a double
+// underscore. The outer fields are split off first and the name decoded last,
+// as Flux does, since an empty group also leaves a double underscore behind.
+func parseInventoryID(id, version string) (metrics.InventoryObject, bool) {
+	namespace, rest, ok := strings.Cut(id, "_")
+	if !ok {
+		return metrics.InventoryObject{}, false
+	}
+	rest, kind, ok := cutLast(rest, "_")
+	if !ok || kind == "" {
+		return metrics.InventoryObject{}, false
+	}
+	name, group, ok := cutLast(rest, "_")
+	if !ok || name == "" {
+		return metrics.InventoryObject{}, false
+	}
+	name = strings.ReplaceAll(name, "__", ":")
+	if strings.Contains(name, "_") {
+		return metrics.InventoryObject{}, false
+	}
+	return metrics.InventoryObject{
+		Namespace: namespace,
+		Name:      name,
+		Group:     group,
+		Kind:      kind,
+		Version:   version,
+	}, true
+}
+
+// cutLast slices s around the last instance of sep
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
+
+// statusKinds are the kinds objectHealth reads the status of, besides the Flux
+// kinds. The chart grants get on exactly these; everything else is only checked
+// for existence through its metadata.
+var statusKinds = map[schema.GroupKind]bool{
+	{Group: "apps", Kind: "Deployment"}:        true,
+	{Group: "apps", Kind: "StatefulSet"}:       true,
+	{Group: "apps", Kind: "DaemonSet"}:         true,
+	{Group: "", Kind: "Pod"}:                   true,
+	{Group: "", Kind: "PersistentVolumeClaim"}: true,
+	{Group: "batch", Kind: "Job"}:              true,
+}
+
+// hasStatusHealth reports whether the health of a kind is judged from its status
+func hasStatusHealth(gk schema.GroupKind) bool {
+	return statusKinds[gk] || strings.HasSuffix(gk.Group, ".toolkit.fluxcd.io")
+}
+
+// inventoryObjectHealth fetches one inventory object and judges its health.
+// Objects of other kinds are healthy if they exist; only their metadata is
+// fetched, and without read access they are Unknown.
+func (c *Client) inventoryObjectHealth(ctx context.Context, obj *metrics.InventoryObject) (string, string) {
+	gk := schema.GroupKind{Group: obj.Group, Kind: obj.Kind}
+	mapping, err := c.restMapper.RESTMapping(gk, obj.Version)
+	if meta.IsNoMatchError(err) {
+		// The CRD may be newer than the cached discovery data
+		c.restMapper.Reset()
+		mapping, err = c.restMapper.RESTMapping(gk, obj.Version)
+	}
+	if err != nil {
+		if meta.IsNoMatchError(err) {
+			return healthMissing, "kind is not served by the cluster"
+		}
+		return healthUnknown, err.Error()
+	}
+
+	namespace := ""
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		namespace = obj.Namespace
+	}
+	var live *unstructured.Unstructured
+	if hasStatusHealth(gk) {
+		live, err = c.dynamicClient.Resource(mapping.Resource).Namespace(namespace).Get(ctx, obj.Name, metav1.GetOptions{})
+	} else {
+		_, err = c.metadataClient.Resource(mapping.Resource).Namespace(namespace).Get(ctx, obj.Name, metav1.GetOptions{})
+	}
+	switch {
+	case apierrors.IsNotFound(err):
+		return healthMissing, "listed in the inventory but not found in the cluster"
+	case apierrors.IsForbidden(err):
+		return healthUnknown, "forbidden"
+	case err != nil:
+		return healthUnknown, err.Error()
+	case live == nil:
+		return healthHealthy, ""
+	}
+
+	return objectHealth(live)
+}
+
+// objectHealth judges the health of a live object from its status
+func objectHealth(obj *unstructured.Unstructured) (string, string) {
+	status := func(fields ...string) int64 {
+		value, _, _ := unstructured.NestedInt64(obj.Object, append([]string{"status"}, fields...)...)
+		return value
+	}
+
+	switch obj.GetKind() {
+	case "Deployment":
+		desired, found, _ := unstructured.NestedInt64(obj.Object, "spec", "replicas")
+		if !found {
+			desired = 1
+		}
+		cond, _ := findCondition(obj.Object, "Available")
+		ready := fmt.Sprintf("%d/%d ready", status("readyReplicas"), desired)
+		if cond.Status == "True" && status("updatedReplicas") >= desired {
+			return healthHealthy, ready
+		}
+		if progressing, _ := findCondition(obj.Object, "Progressing"); progressing.Status == "True" && cond.Status != "False" {
+			return healthProgressing, ready
+		}
+		return healthUnhealthy, ready
+
+	case "StatefulSet":
+		desired, found, _ := unstructured.NestedInt64(obj.Object, "spec", "replicas")
+		if !found {
+			desired = 1
+		}
+		ready := fmt.Sprintf("%d/%d ready", status("readyReplicas"), desired)
+		if status("readyReplicas") >= desired {
+			return healthHealthy, ready
+		}
+		return healthProgressing, ready
+
+	case "DaemonSet":
+		desired := status("desiredNumberScheduled")
+		ready := fmt.Sprintf("%d/%d ready", status("numberReady"), desired)
+		if status("numberReady") >= desired {
+			return healthHealthy, ready
+		}
+		return healthProgressing, ready
+
+	case "Pod":
+		phase, _, _ := unstructured.NestedString(obj.Object, "status", "phase")
+		if phase == "Succeeded" {
+			return healthHealthy, phase
+		}
+		if cond, _ := findCondition(obj.Object, "Ready"); cond.Status == "True" {
+			return healthHealthy, phase
+		}
+		if phase == "Failed" {
+			return healthUnhealthy, phase
+		}
+		return healthProgressing, phase
+
+	case "PersistentVolumeClaim":
+		phase, _, _ := unstructured.NestedString(obj.Object, "status", "phase")
+		switch phase {
+		case "Bound":
+			return healthHealthy, phase
+		case "Lost":
+			return healthUnhealthy, phase
+		}
+		return healthProgressing, phase
+
+	case "Job":
+		if cond, _ := findCondition(obj.Object, "Complete"); cond.Status == "True" {
+			return healthHealthy, "succeeded"
+		}
+		if cond, _ := findCondition(obj.Object, "Failed"); cond.Status == "True" {
+			return healthUnhealthy, cond.Message
+		}
+		return healthProgressing, fmt.Sprintf("%d active", status("active"))
+	}
+
+	// Flux objects and most CRDs report a Ready condition
+	if cond, found := findCondition(obj.Object, "Ready"); found {
+		switch cond.Status {
+		case "True":
+			return healthHealthy, cond.Reason
+		case "False":
+			return healthUnhealthy, cond.Message
+		}
+		return healthProgressing, cond.Message
+	}
+
+	// Objects without status (ConfigMaps, Services, RBAC, ...) are healthy if they exist
+	return healthHealthy, ""
+}
+
+// groupInventory builds the namespace -> kind -> object tree, sorted at every level
+func groupInventory(objects []metrics.InventoryObject) []metrics.InventoryNamespace {
+	tree := make(map[string]map[string][]metrics.InventoryObject)
+	for _, obj := range objects {
+		if tree[obj.Namespace] == nil {
+			tree[obj.Namespace] = make(map[string][]metrics.InventoryObject)
+		}
+		tree[obj.Namespace][obj.Kind] = append(tree[obj.Namespace][obj.Kind], obj)
+	}
+
+	namespaces := make([]metrics.InventoryNamespace, 0, len(tree))
+	for namespace, kinds := range tree {
+		group := metrics.InventoryNamespace{Namespace: namespace}
+		for kind, objs := range kinds {
+			sort.Slice(objs, func(i, j int) bool { return objs[i].Name < objs[j].Name })
+			group.Kinds = append(group.Kinds, metrics.InventoryKind{Kind: kind, Objects: objs})
+		}
+		sort.Slice(group.Kinds, func(i, j int) bool { return group.Kinds[i].Kind < group.Kinds[j].Kind })
+		namespaces = append(namespaces, group)
+	}
+	sort.Slice(namespaces, func(i, j int) bool { return namespaces[i].Namespace < namespaces[j].Namespace })
+
+	return namespaces
+}
@@ -0,0 +1,214 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pi-cluster/cluster-dashboard/internal/metrics"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// drainPollInterval is how often a drain retries blocked evictions and checks for pods still on the node
+const drainPollInterval = 5 * time.Second
+
+// mirrorPodAnnotation marks static pods, which the kubelet owns and eviction cannot remove
+const mirrorPodAnnotation = "kubernetes.io/config.mirror"
+
+// CordonNode marks a node unschedulable, or schedulable again, like kubectl cordon/uncordon
+func (c *Client) CordonNode(ctx context.Context, name string, cordon bool) error {
+	patch := fmt.Sprintf(`{"spec":{"unschedulable":%t}}`, cordon)
+	_, err := c.clientset.CoreV1().Nodes().Patch(ctx, name, types.StrategicMergePatchType, []byte(patch), metav1.PatchOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to set unschedulable=%t on node %s: %w", cordon, name, err)
+	}
+	return nil
+}
+
+// DrainNode evicts the pods on a node and waits until they are gone, like
+// kubectl drain --ignore-daemonsets --delete-emptydir-data. Evictions go
+// through the Eviction API so PodDisruptionBudgets are respected: a blocked
+// eviction is retried until ctx is done. progress, when set, is called after
+// every pass with the pods still on the node.
+//
+// Pods without a controller would not be recreated elsewhere, so the drain
+// refuses to start while there are any, as kubectl does without --force.
+func (c *Client) DrainNode(ctx context.Context, name string, progress func(remaining []string)) error {
+	for {
+		pods, err := c.clientset.CoreV1().Pods("").List(ctx, metav1.ListOptions{FieldSelector: "spec.nodeName=" + name})
+		if err != nil {
+			return fmt.Errorf("failed to list pods on node %s: %w", name, err)
+		}
+
+		evict, unmanaged := classifyPods(pods.Items)
+		if len(unmanaged) > 0 {
+			return fmt.Errorf("node %s has pods without a controller that would be lost: %s", name, strings.Join(podIDs(unmanaged), ", "))
+		}
+
+		var remaining, blocked []string
+		for _, pod := range evict {
+			id := pod.Namespace + "/" + pod.Name
+			remaining = append(remaining, id)
+			if pod.DeletionTimestamp != nil {
+				continue
+			}
+
+			eviction := &policyv1.Eviction{ObjectMeta: metav1.ObjectMeta{Name: pod.Name, Namespace: pod.Namespace}}
+			err := c.clientset.PolicyV1().Evictions(pod.Namespace).Evict(ctx, eviction)
+			switch {
+			case err == nil, apierrors.IsNotFound(err):
+			case apierrors.IsTooManyRequests(err):
+				// A PodDisruptionBudget does not allow the disruption yet
+				blocked = append(blocked, id)
+			default:
+				return fmt.Errorf("failed to evict %s: %w", id, err)
+			}
+		}
+
+		sort.Strings(remaining)
+		if progress != nil {
+			progress(remaining)
+		}
+		if len(remaining) == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			if len(blocked) > 0 {
+				sort.Strings(blocked)
+				return fmt.Errorf("drain of %s timed out: evictions blocked by a PodDisruptionBudget: %s", name, strings.Join(blocked, ", "))
+			}
+			return fmt.Errorf("drain of %s timed out with %d pods still terminating: %s", name, len(remaining), strings.Join(remaining, ", "))
+		case <-time.After(drainPollInterval):
+		}
+	}
+}
+
+// GetDrainPlan lists what draining a node would evict, with the
+// PodDisruptionBudgets that would hold evictions back right now
+func (c *Client) GetDrainPlan(ctx context.Context, name string) (*metrics.DrainPlan, error) {
+	if !c.hasSynced() {
+		return nil, errCacheNotSynced
+	}
+
+	node, err := c.nodeLister.Get(name)
+	if apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("node %s: %w", name, metrics.ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get node %s: %w", name, err)
+	}
+	pods, err := c.podLister.List(labels.Everything())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods: %w", err)
+	}
+	budgets, err := c.clientset.PolicyV1().PodDisruptionBudgets("").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list PodDisruptionBudgets: %w", err)
+	}
+
+	plan := &metrics.DrainPlan{
+		Node:      name,
+		Cordoned:  node.Spec.Unschedulable,
+		Evict:     []metrics.DrainPod{},
+		Unmanaged: []metrics.DrainPod{},
+		Skipped:   []metrics.DrainPod{},
+	}
+	for _, pod := range pods {
+		if pod.Spec.NodeName != name {
+			continue
+		}
+		drainPod := metrics.DrainPod{
+			Namespace:   pod.Namespace,
+			Name:        pod.Name,
+			Terminating: pod.DeletionTimestamp != nil,
+		}
+		if owner := metav1.GetControllerOf(pod); owner != nil {
+			drainPod.Owner = owner.Kind + "/" + owner.Name
+		}
+		switch {
+		case skippedByDrain(pod):
+			plan.Skipped = append(plan.Skipped, drainPod)
+		case drainPod.Owner == "":
+			plan.Unmanaged = append(plan.Unmanaged, drainPod)
+		default:
+			drainPod.BlockedBy = blockingBudget(pod, budgets.Items)
+			plan.Evict = append(plan.Evict, drainPod)
+		}
+	}
+	for _, list := range [][]metrics.DrainPod{plan.Evict, plan.Unmanaged, plan.Skipped} {
+		sort.Slice(list, func(i, j int) bool {
+			return list[i].Namespace+"/"+list[i].Name < list[j].Namespace+"/"+list[j].Name
+		})
+	}
+	return plan, nil
+}
+
+// blockingBudget returns the PodDisruptionBudget covering the pod that allows
+// no disruption at the moment, or "" when it can be evicted now
+func blockingBudget(pod *corev1.Pod, budgets []policyv1.PodDisruptionBudget) string {
+	for _, budget := range budgets {
+		if budget.Namespace != pod.Namespace || budget.Status.DisruptionsAllowed > 0 {
+			continue
+		}
+		// A null selector matches no pods, an empty one every pod in the namespace
+		selector, err := metav1.LabelSelectorAsSelector(budget.Spec.Selector)
+		if err != nil {
+			continue
+		}
+		if selector.Matches(labels.Set(pod.Labels)) {
+			return budget.Name
+		}
+	}
+	return ""
+}
+
+// classifyPods picks the pods a drain has to remove and splits off those
+// without a controller, which would not be recreated elsewhere
+func classifyPods(pods []corev1.Pod) (evict, unmanaged []*corev1.Pod) {
+	for i := range pods {
+		pod := &pods[i]
+		switch {
+		case skippedByDrain(pod):
+		case metav1.GetControllerOf(pod) == nil:
+			unmanaged = append(unmanaged, pod)
+		default:
+			evict = append(evict, pod)
+		}
+	}
+	return evict, unmanaged
+}
+
+// skippedByDrain reports whether a drain leaves the pod where it is. DaemonSet
+// pods would be recreated on the node straight away, mirror pods cannot be
+// evicted and finished pods no longer run.
+func skippedByDrain(pod *corev1.Pod) bool {
+	if _, ok := pod.Annotations[mirrorPodAnnotation]; ok {
+		return true
+	}
+	if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+		return true
+	}
+	if owner := metav1.GetControllerOf(pod); owner != nil && owner.Kind == "DaemonSet" {
+		return true
+	}
+	return false
+}
+
+// podIDs returns namespace/name of each pod in order
+func podIDs(pods []*corev1.Pod) []string {
+	ids := make([]string, 0, len(pods))
+	for _, pod := range pods {
+		ids = append(ids, pod.Namespace+"/"+pod.Name)
+	}
+	sort.Strings(ids)
+	return ids
+}
@@ -0,0 +1,338 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pi-cluster/cluster-dashboard/internal/metrics"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+)
+
+// upgradeConfigMap holds the current upgrade run so every replica, and a restarted pod, sees the same progress
+const upgradeConfigMap = "cluster-dashboard-upgrade"
+
+// upgradeLease names the Lease held by the replica executing the upgrade run
+const upgradeLease = "cluster-dashboard-upgrade"
+
+// upgradeRunKey is the ConfigMap key the run is stored under as JSON
+const upgradeRunKey = "run.json"
+
+// serviceAccountNamespace is the namespace file mounted into every pod
+const serviceAccountNamespace = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// podNamespace returns POD_NAMESPACE, then the service account's namespace,
+// then the namespace the dashboard is deployed to
+func podNamespace() string {
+	if namespace := os.Getenv("POD_NAMESPACE"); namespace != "" {
+		return namespace
+	}
+	if data, err := os.ReadFile(serviceAccountNamespace); err == nil {
+		if namespace := strings.TrimSpace(string(data)); namespace != "" {
+			return namespace
+		}
+	}
+	return "cluster-dashboard"
+}
+
+// LoadUpgradeRun reads the stored upgrade run. It returns nil when there is none.
+func (c *Client) LoadUpgradeRun(ctx context.Context) (*metrics.UpgradeRun, error) {
+	cm, err := c.clientset.CoreV1().ConfigMaps(podNamespace()).Get(ctx, upgradeConfigMap, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read upgrade state: %w", err)
+	}
+
+	data, ok := cm.Data[upgradeRunKey]
+	if !ok {
+		return nil, nil
+	}
+	var run metrics.UpgradeRun
+	if err := json.Unmarshal([]byte(data), &run); err != nil {
+		return nil, fmt.Errorf("failed to parse upgrade state: %w", err)
+	}
+	return &run, nil
+}
+
+// SaveUpgradeRun stores the upgrade run, creating the ConfigMap on first use.
+// An update that races another replica's write is retried on the latest version.
+func (c *Client) SaveUpgradeRun(ctx context.Context, run *metrics.UpgradeRun) error {
+	data, err := json.Marshal(run)
+	if err != nil {
+		return fmt.Errorf("failed to encode upgrade state: %w", err)
+	}
+
+	configMaps := c.clientset.CoreV1().ConfigMaps(podNamespace())
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm, err := configMaps.Get(ctx, upgradeConfigMap, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			cm = &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   upgradeConfigMap,
+					Labels: map[string]string{"app.kubernetes.io/name": "cluster-dashboard"},
+				},
+				Data: map[string]string{upgradeRunKey: string(data)},
+			}
+			if _, err := configMaps.Create(ctx, cm, metav1.CreateOptions{}); err != nil {
+				if apierrors.IsAlreadyExists(err) {
+					// Created by the other replica meanwhile: update it instead
+					return apierrors.NewConflict(corev1.Resource("configmaps"), upgradeConfigMap, err)
+				}
+				return fmt.Errorf("failed to create upgrade state: %w", err)
+			}
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read upgrade state: %w", err)
+		}
+
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
+		}
+		cm.Data[upgradeRunKey] = string(data)
+		if _, err := configMaps.Update(ctx, cm, metav1.UpdateOptions{}); err != nil {
+			if apierrors.IsConflict(err) {
+				return err
+			}
+			return fmt.Errorf("failed to save upgrade state: %w", err)
+		}
+		return nil
+	})
+}
+
+// AcquireUpgradeLease takes the upgrade lease for holder, or renews it when
+// holder has it already. It fails with metrics.ErrLeaseHeld while another
+// holder's lease has not expired.
+func (c *Client) AcquireUpgradeLease(ctx context.Context, holder string, duration time.Duration) error {
+	leases := c.clientset.CoordinationV1().Leases(podNamespace())
+	seconds := int32(duration / time.Second)
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		now := metav1.NewMicroTime(time.Now())
+		lease, err := leases.Get(ctx, upgradeLease, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			lease = &coordinationv1.Lease{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   upgradeLease,
+					Labels: map[string]string{"app.kubernetes.io/name": "cluster-dashboard"},
+				},
+				Spec: coordinationv1.LeaseSpec{
+					HolderIdentity:       &holder,
+					LeaseDurationSeconds: &seconds,
+					AcquireTime:          &now,
+					RenewTime:            &now,
+				},
+			}
+			if _, err := leases.Create(ctx, lease, metav1.CreateOptions{}); err != nil {
+				if apierrors.IsAlreadyExists(err) {
+					return apierrors.NewConflict(coordinationv1.Resource("leases"), upgradeLease, err)
+				}
+				return fmt.Errorf("failed to create upgrade lease: %w", err)
+			}
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read upgrade lease: %w", err)
+		}
+
+		current, expires := leaseHolder(lease)
+		if current != "" && current != holder && time.Now().Before(expires) {
+			return fmt.Errorf("%w: %s until %s", metrics.ErrLeaseHeld, current, expires.Format(time.RFC3339))
+		}
+		if current != holder {
+			lease.Spec.AcquireTime = &now
+		}
+		lease.Spec.HolderIdentity = &holder
+		lease.Spec.LeaseDurationSeconds = &seconds
+		lease.Spec.RenewTime = &now
+		if _, err := leases.Update(ctx, lease, metav1.UpdateOptions{}); err != nil {
+			if apierrors.IsConflict(err) {
+				return err
+			}
+			return fmt.Errorf("failed to renew upgrade lease: %w", err)
+		}
+		return nil
+	})
+}
+
+// ReleaseUpgradeLease gives the upgrade lease up if holder has it, so another
+// replica can resume without waiting for it to expire
+func (c *Client) ReleaseUpgradeLease(ctx context.Context, holder string) error {
+	leases := c.clientset.CoordinationV1().Leases(podNamespace())
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		lease, err := leases.Get(ctx, upgradeLease, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read upgrade lease: %w", err)
+		}
+		if current, _ := leaseHolder(lease); current != holder {
+			return nil
+		}
+
+		lease.Spec.HolderIdentity = nil
+		if _, err := leases.Update(ctx, lease, metav1.UpdateOptions{}); err != nil {
+			if apierrors.IsConflict(err) {
+				return err
+			}
+			return fmt.Errorf("failed to release upgrade lease: %w", err)
+		}
+		return nil
+	})
+}
+
+// UpgradeLeaseHolder returns the replica holding an unexpired upgrade lease,
+// or an empty string when nobody does
+func (c *Client) UpgradeLeaseHolder(ctx context.Context) (string, error) {
+	lease, err := c.clientset.CoordinationV1().Leases(podNamespace()).Get(ctx, upgradeLease, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read upgrade lease: %w", err)
+	}
+	holder, expires := leaseHolder(lease)
+	if holder == "" || !time.Now().Before(expires) {
+		return "", nil
+	}
+	return holder, nil
+}
+
+// leaseHolder returns who holds a lease and when it expires unless renewed
+func leaseHolder(lease *coordinationv1.Lease) (string, time.Time) {
+	if lease.Spec.HolderIdentity == nil || lease.Spec.RenewTime == nil || lease.Spec.LeaseDurationSeconds == nil {
+		return "", time.Time{}
+	}
+	expires := lease.Spec.RenewTime.Add(time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second)
+	return *lease.Spec.HolderIdentity, expires
+}
+
+// controlPlaneComponents are the static pods Talos runs on every control plane
+var controlPlaneComponents = []string{"kube-apiserver", "kube-controller-manager", "kube-scheduler"}
+
+// kubeProxy names the kube-proxy DaemonSet and its container in kube-system,
+// as deployed by Talos' bootstrap manifests
+const kubeProxy = "kube-proxy"
+
+// ControlPlaneVersions returns the image tag of each control plane static pod
+// on a node, read from the informer cache. Components that are not running or
+// not Ready are left out.
+func (c *Client) ControlPlaneVersions(ctx context.Context, node string) (map[string]string, error) {
+	if !c.hasSynced() {
+		return nil, errCacheNotSynced
+	}
+	pods, err := c.podLister.Pods(metav1.NamespaceSystem).List(labels.Everything())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list kube-system pods: %w", err)
+	}
+
+	versions := make(map[string]string, len(controlPlaneComponents))
+	for _, pod := range pods {
+		if pod.Spec.NodeName != node || pod.Annotations[mirrorPodAnnotation] == "" || !podReady(pod) {
+			continue
+		}
+		for _, container := range pod.Spec.Containers {
+			if slices.Contains(controlPlaneComponents, container.Name) {
+				versions[container.Name] = imageTag(container.Image)
+			}
+		}
+	}
+	return versions, nil
+}
+
+// podReady reports whether a pod's Ready condition is true
+func podReady(pod *corev1.Pod) bool {
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == corev1.PodReady {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// KubeProxyVersion returns the image tag of the kube-proxy DaemonSet and
+// whether every pod runs it, or "" when the cluster has no kube-proxy
+func (c *Client) KubeProxyVersion(ctx context.Context) (string, bool, error) {
+	if !c.hasSynced() {
+		return "", false, errCacheNotSynced
+	}
+	ds, err := c.daemonSetLister.DaemonSets(metav1.NamespaceSystem).Get(kubeProxy)
+	if apierrors.IsNotFound(err) {
+		return "", true, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to get the kube-proxy DaemonSet: %w", err)
+	}
+
+	version := ""
+	for _, container := range ds.Spec.Template.Spec.Containers {
+		if container.Name == kubeProxy {
+			version = imageTag(container.Image)
+		}
+	}
+	desired := ds.Status.DesiredNumberScheduled
+	rolledOut := ds.Status.ObservedGeneration >= ds.Generation &&
+		ds.Status.UpdatedNumberScheduled == desired && ds.Status.NumberAvailable == desired
+	return version, rolledOut, nil
+}
+
+// SetKubeProxyVersion moves the kube-proxy DaemonSet to version, keeping its
+// image repository, like talosctl upgrade-k8s does
+func (c *Client) SetKubeProxyVersion(ctx context.Context, version string) error {
+	ds, err := c.clientset.AppsV1().DaemonSets(metav1.NamespaceSystem).Get(ctx, kubeProxy, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get the kube-proxy DaemonSet: %w", err)
+	}
+	image := ""
+	for _, container := range ds.Spec.Template.Spec.Containers {
+		if container.Name == kubeProxy {
+			image = container.Image
+		}
+	}
+	if image == "" {
+		return fmt.Errorf("the kube-proxy DaemonSet has no %s container", kubeProxy)
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"containers": []map[string]string{{"name": kubeProxy, "image": imageRepository(image) + ":" + version}},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = c.clientset.AppsV1().DaemonSets(metav1.NamespaceSystem).Patch(ctx, kubeProxy, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to update the kube-proxy DaemonSet to %s: %w", version, err)
+	}
+	return nil
+}
+
+// imageRepository strips the tag and digest from an image reference
+func imageRepository(image string) string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image = image[:i]
+	}
+	return image
+}
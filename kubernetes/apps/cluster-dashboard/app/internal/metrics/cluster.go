@@ -2,42 +2,93 @@ package metrics
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 )
 
+// Default collection limits, see SetLimits
+const (
+	DefaultSourceTimeout = 10 * time.Second
+	DefaultCollectBudget = 25 * time.Second
+)
+
+// Sections of ClusterMetrics, the keys of ClusterMetrics.Sections
+const (
+	SectionHardware     = "hardware" // Nodes and the per-node Talos data
+	SectionTalos        = "talos"
+	SectionInventory    = "talos_inventory"
+	SectionEtcd         = "etcd"
+	SectionKubernetes   = "kubernetes"
+	SectionFlux         = "flux"
+	SectionApplications = "applications"
+)
+
+// Section states
+const (
+	SectionFresh       = "fresh"
+	SectionStale       = "stale"       // Collection failed, the data is from an earlier collect
+	SectionUnavailable = "unavailable" // Collection failed and there is no earlier data
+)
+
 // ClusterMetrics holds all cluster health information
 type ClusterMetrics struct {
-	Hardware     HardwareStatus    `json:"hardware"`
-	Talos        TalosStatus       `json:"talos"`
-	Kubernetes   KubernetesStatus  `json:"kubernetes"`
-	Flux         FluxStatus        `json:"flux"`
-	Applications []AppStatus       `json:"applications"`
-	UpdatedAt    time.Time         `json:"updated_at"`
+	Hardware     HardwareStatus           `json:"hardware"`
+	Talos        TalosStatus              `json:"talos"`
+	Etcd         EtcdStatus               `json:"etcd"`
+	Kubernetes   KubernetesStatus         `json:"kubernetes"`
+	Flux         FluxStatus               `json:"flux"`
+	Applications []AppStatus              `json:"applications"`
+	Sections     map[string]SectionStatus `json:"sections"` // Freshness and error of each section
+	UpdatedAt    time.Time                `json:"updated_at"`
+}
+
+// SectionStatus is how one section of ClusterMetrics was collected
+type SectionStatus struct {
+	State     string    `json:"state"`           // One of the Section* states
+	UpdatedAt time.Time `json:"updated_at"`      // When the data shown was collected, zero when unavailable
+	Error     string    `json:"error,omitempty"` // Why the latest collection failed
 }
 
 // HardwareStatus represents physical hardware information
 type HardwareStatus struct {
-	NodeCount       int               `json:"node_count"`
-	ControlPlanes   int               `json:"control_planes"`
-	Workers         int               `json:"workers"`
-	TotalCPU        string            `json:"total_cpu"`
-	TotalMemory     string            `json:"total_memory"`
-	Storage         string            `json:"storage"`
-	AllNodesReady   bool              `json:"all_nodes_ready"`
-	NodeDetails     []NodeDetail      `json:"node_details"`
+	NodeCount     int          `json:"node_count"`
+	ControlPlanes int          `json:"control_planes"`
+	Workers       int          `json:"workers"`
+	TotalCPU      string       `json:"total_cpu"`
+	TotalMemory   string       `json:"total_memory"`
+	Storage       string       `json:"storage"`
+	AllNodesReady bool         `json:"all_nodes_ready"`
+	NodeDetails   []NodeDetail `json:"node_details"`
 }
 
 // NodeDetail holds per-node information
 type NodeDetail struct {
-	Name         string  `json:"name"`
-	IP           string  `json:"ip"`
-	Role         string  `json:"role"`
-	Status       string  `json:"status"`
-	CPUUsage     float64 `json:"cpu_usage"`
-	MemoryUsage  float64 `json:"memory_usage"`
-	Temperature  float64 `json:"temperature"`
-	IsReady      bool    `json:"is_ready"`
+	Name        string  `json:"name"`
+	IP          string  `json:"ip"`
+	Role        string  `json:"role"`
+	Status      string  `json:"status"`
+	CPUUsage    float64 `json:"cpu_usage"`
+	MemoryUsage float64 `json:"memory_usage"`
+	Temperature float64 `json:"temperature"`
+	IsReady     bool    `json:"is_ready"`
+	Cordoned    bool    `json:"cordoned"` // spec.unschedulable
+
+	KubeletVersion string `json:"kubelet_version"` // status.nodeInfo.kubeletVersion
+
+	TemperatureStatus string          `json:"temperature_status"` // One of the Temperature* states
+	TemperatureError  string          `json:"temperature_error,omitempty"`
+	ThermalZones      []ThermalZone   `json:"thermal_zones"`
+	CoolingDevices    []CoolingDevice `json:"cooling_devices"`
+	Power             NodePower       `json:"power"`
+	Storage           NodeStorage     `json:"storage"`
+	DiskIO            NodeDiskIO      `json:"disk_io"`
+	Network           NodeNetwork     `json:"network"`
+	ConfigDrift       NodeConfigDrift `json:"config_drift"`
 }
 
 // TalosStatus represents Talos Linux health
@@ -45,7 +96,35 @@ type TalosStatus struct {
 	Version       string            `json:"version"`
 	ClusterHealth string            `json:"cluster_health"`
 	Services      map[string]string `json:"services"` // service name -> status
+	Nodes         []TalosNode       `json:"nodes"`
+	VIP           VIPStatus         `json:"vip"`
+	Inventory     TalosInventory    `json:"inventory"` // Configured endpoints against Kubernetes nodes
 	Healthy       bool              `json:"healthy"`
+	Error         string            `json:"error,omitempty"` // Why Talos could not be queried
+}
+
+// TalosNode represents the Talos state of a single node
+type TalosNode struct {
+	Node            string         `json:"node"` // Address the API was queried at
+	Hostname        string         `json:"hostname"`
+	Version         string         `json:"version"`
+	Stage           string         `json:"stage"` // Machine stage: booting, running, upgrading, ...
+	MachineReady    bool           `json:"machine_ready"`
+	UnmetConditions []string       `json:"unmet_conditions,omitempty"`
+	Services        []TalosService `json:"services"`
+	HoldsVIP        bool           `json:"holds_vip"`
+	Reachable       bool           `json:"reachable"`
+	Healthy         bool           `json:"healthy"`
+	Error           string         `json:"error,omitempty"`
+}
+
+// TalosService represents one Talos system service on a node
+type TalosService struct {
+	ID      string `json:"id"`
+	State   string `json:"state"`  // Running, Waiting, Failed, ...
+	Health  string `json:"health"` // Healthy, Unhealthy or Unknown (no health check)
+	Message string `json:"message,omitempty"`
+	Healthy bool   `json:"healthy"`
 }
 
 // KubernetesStatus represents Kubernetes cluster health
@@ -73,31 +152,69 @@ type AppStatus struct {
 
 // FluxStatus represents Flux GitOps status
 type FluxStatus struct {
-	Version         string           `json:"version"`
-	GitRepository   string           `json:"git_repository"`
-	LastSync        string           `json:"last_sync"`
-	Kustomizations  []FluxResource   `json:"kustomizations"`
-	HelmReleases    []FluxResource   `json:"helm_releases"`
-	RecentActivity  []FluxEvent      `json:"recent_activity"`
-	Healthy         bool             `json:"healthy"`
+	Version        string           `json:"version"`
+	VersionSkew    bool             `json:"version_skew"` // Controllers report different distribution versions or image release lines
+	Controllers    []FluxController `json:"controllers"`
+	GitRepository  string           `json:"git_repository"`
+	LastSync       string           `json:"last_sync"`
+	Sources        []FluxSource     `json:"sources"`
+	Kustomizations []FluxResource   `json:"kustomizations"`
+	HelmReleases   []FluxResource   `json:"helm_releases"`
+	RecentActivity []FluxEvent      `json:"recent_activity"`
+	Healthy        bool             `json:"healthy"`
 }
 
 // FluxResource represents a Flux resource (Kustomization or HelmRelease)
 type FluxResource struct {
-	Name         string `json:"name"`
-	Namespace    string `json:"namespace"`
-	Ready        bool   `json:"ready"`
-	Status       string `json:"status"`
-	Revision     string `json:"revision"`
-	ChartVersion string `json:"chart_version,omitempty"` // For HelmReleases
-	Age          string `json:"age,omitempty"`           // Human-readable age
+	Name                  string   `json:"name"`
+	Namespace             string   `json:"namespace"`
+	Ready                 bool     `json:"ready"`
+	Status                string   `json:"status"`
+	Reason                string   `json:"reason,omitempty"`  // Ready condition reason
+	Message               string   `json:"message,omitempty"` // Ready condition message
+	Revision              string   `json:"revision"`
+	LastAppliedRevision   string   `json:"last_applied_revision,omitempty"`
+	LastAttemptedRevision string   `json:"last_attempted_revision,omitempty"`
+	Suspended             bool     `json:"suspended"`
+	DependsOn             []string `json:"depends_on,omitempty"`
+	ChartVersion          string   `json:"chart_version,omitempty"` // For HelmReleases
+	Age                   string   `json:"age,omitempty"`           // Human-readable age
+}
+
+// FluxController represents one of the Flux controller Deployments
+type FluxController struct {
+	Name                string `json:"name"`
+	Image               string `json:"image"`
+	Version             string `json:"version"`              // Image tag
+	Release             string `json:"release"`              // Flux release line the image tag ships in, e.g. v2.7
+	DistributionVersion string `json:"distribution_version"` // app.kubernetes.io/version label
+	ReadyReplicas       string `json:"ready_replicas"`
+	Ready               bool   `json:"ready"`
+	Status              string `json:"status"`
+}
+
+// FluxSource represents a Flux source (GitRepository, HelmRepository, OCIRepository or HelmChart)
+type FluxSource struct {
+	Kind        string    `json:"kind"`
+	Name        string    `json:"name"`
+	Namespace   string    `json:"namespace"`
+	URL         string    `json:"url"`
+	Revision    string    `json:"revision"`     // Artifact revision
+	LastFetched time.Time `json:"last_fetched"` // Artifact lastUpdateTime
+	LastSync    string    `json:"last_sync"`    // Human-readable time since LastFetched
+	Ready       bool      `json:"ready"`
+	Status      string    `json:"status"`
+	Reason      string    `json:"reason,omitempty"`
+	Message     string    `json:"message,omitempty"`
+	Suspended   bool      `json:"suspended"`
 }
 
 // FluxEvent represents a recent Flux activity event
 type FluxEvent struct {
 	Time     string `json:"time"`
-	Type     string `json:"type"`
+	Type     string `json:"type"` // Normal or Warning
 	Resource string `json:"resource"`
+	Reason   string `json:"reason"`
 	Message  string `json:"message"`
 }
 
@@ -106,13 +223,35 @@ type Collector interface {
 	Collect(ctx context.Context) (*ClusterMetrics, error)
 }
 
-// MetricsCollector aggregates data from multiple sources
+// MetricsCollector aggregates data from multiple sources. Requests are served
+// from the cache; collects run one at a time in the background.
 type MetricsCollector struct {
 	k8sClient   K8sClient
 	talosClient TalosClient
+	cacheTTL    time.Duration
+
+	// Each source call gets sourceTimeout and a whole collect collectBudget;
+	// sections still missing when it runs out are reported stale or unavailable
+	sourceTimeout time.Duration
+	collectBudget time.Duration
+
+	mu          sync.Mutex
+	ctx         context.Context // Collects stop when it is cancelled, set by Start
 	cache       *ClusterMetrics
 	cacheExpiry time.Time
-	cacheTTL    time.Duration
+	refreshing  *refresh // Collect in progress, shared by everyone asking for one
+	recorders   []Recorder
+}
+
+// Recorder is given the result of every collect, e.g. to keep a history
+type Recorder interface {
+	Record(metrics *ClusterMetrics)
+}
+
+// refresh is one collect in progress
+type refresh struct {
+	done    chan struct{} // Closed once metrics is set
+	metrics *ClusterMetrics
 }
 
 // K8sClient interface for Kubernetes operations
@@ -127,7 +266,14 @@ type K8sClient interface {
 type TalosClient interface {
 	GetTalosStatus(ctx context.Context) (*TalosStatus, error)
 	GetVersion(ctx context.Context) (string, error)
-	GetNodeTemperature(ctx context.Context, nodeIP string) (float64, error)
+	GetNodeThermals(ctx context.Context, nodeIP string) (*NodeThermals, error)
+	GetEtcdStatus(ctx context.Context) (*EtcdStatus, error)
+	GetNodePower(ctx context.Context, nodeIP string) (*NodePower, error)
+	GetNodeStorage(ctx context.Context, nodeIP string) (*NodeStorage, error)
+	GetNodeDiskIO(ctx context.Context, nodeIP string) (*NodeDiskIO, error)
+	GetNodeNetwork(ctx context.Context, nodeIP, hostname string) (*NodeNetwork, error)
+	GetNodeConfigDrift(ctx context.Context, nodeIP, hostname string) (*NodeConfigDrift, error)
+	GetTalosInventory(ctx context.Context) (*TalosInventory, error)
 }
 
 // NewMetricsCollector creates a new metrics collector
@@ -136,69 +282,326 @@ func NewMetricsCollector(k8s K8sClient, talos TalosClient, cacheTTL time.Duratio
 		k8sClient:   k8s,
 		talosClient: talos,
 		cacheTTL:    cacheTTL,
+		ctx:         context.Background(),
+
+		sourceTimeout: DefaultSourceTimeout,
+		collectBudget: DefaultCollectBudget,
 	}
 }
 
-// Collect gathers all cluster metrics with caching
+// SetLimits sets the timeout of each source call and the budget of a whole
+// collect. Call it before Start.
+func (mc *MetricsCollector) SetLimits(sourceTimeout, collectBudget time.Duration) {
+	mc.sourceTimeout = sourceTimeout
+	mc.collectBudget = collectBudget
+}
+
+// AddRecorder has r record every collect from now on. Recorders are called in
+// collect order, before the collect is served.
+func (mc *MetricsCollector) AddRecorder(r Recorder) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	mc.recorders = append(mc.recorders, r)
+}
+
+// Start collects now and then every interval until ctx is cancelled, which
+// also ends a collect in progress. With an interval no longer than the cache
+// TTL, requests never wait for a collect.
+func (mc *MetricsCollector) Start(ctx context.Context, interval time.Duration) {
+	mc.mu.Lock()
+	mc.ctx = ctx
+	mc.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			mc.mu.Lock()
+			pending := mc.startRefresh()
+			mc.mu.Unlock()
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-pending.done:
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Collect returns the cached metrics. Once they are older than the cache TTL
+// they are still returned while a refresh runs in the background
+// (stale-while-revalidate); only a call before the first collect has finished
+// waits for it. The returned error is only set when ctx ends that wait.
 func (mc *MetricsCollector) Collect(ctx context.Context) (*ClusterMetrics, error) {
-	// Return cached data if still valid
-	if mc.cache != nil && time.Now().Before(mc.cacheExpiry) {
-		return mc.cache, nil
+	mc.mu.Lock()
+	cached := mc.cache
+	var pending *refresh
+	if cached == nil || time.Now().After(mc.cacheExpiry) {
+		pending = mc.startRefresh()
 	}
+	mc.mu.Unlock()
 
-	// Gather fresh metrics
-	metrics := &ClusterMetrics{
-		UpdatedAt: time.Now(),
+	if cached != nil {
+		return cached, nil
+	}
+	select {
+	case <-pending.done:
+		return pending.metrics, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("waiting for the first collect: %w", ctx.Err())
 	}
+}
 
-	// Collect Kubernetes metrics
-	nodes, err := mc.k8sClient.GetNodeMetrics(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get node metrics: %w", err)
+// startRefresh starts a collect unless one is already running, and returns the
+// one running. Callers coalesce on it instead of collecting again. mc.mu must be held.
+func (mc *MetricsCollector) startRefresh() *refresh {
+	if mc.refreshing != nil {
+		return mc.refreshing
 	}
 
-	// Enrich nodes with temperature data from Talos
-	for i := range nodes {
-		if nodes[i].IP != "" {
-			temp, err := mc.talosClient.GetNodeTemperature(ctx, nodes[i].IP)
-			if err == nil {
-				nodes[i].Temperature = temp
-			}
+	pending := &refresh{done: make(chan struct{})}
+	mc.refreshing = pending
+	ctx, last, recorders := mc.ctx, mc.cache, mc.recorders
+	go func() {
+		metrics := mc.collect(ctx, last)
+		for _, r := range recorders {
+			r.Record(metrics)
 		}
+
+		mc.mu.Lock()
+		mc.cache = metrics
+		mc.cacheExpiry = time.Now().Add(mc.cacheTTL)
+		mc.refreshing = nil
+		mc.mu.Unlock()
+
+		pending.metrics = metrics
+		close(pending.done)
+	}()
+	return pending
+}
+
+// collect gathers all cluster metrics. Sources are queried concurrently, each
+// within sourceTimeout and all within collectBudget, so a slow or failing
+// source never fails the whole collect: its section keeps its data from last,
+// marked stale, or is marked unavailable.
+func (mc *MetricsCollector) collect(ctx context.Context, last *ClusterMetrics) *ClusterMetrics {
+	ctx, cancel := context.WithTimeoutCause(ctx, mc.collectBudget,
+		fmt.Errorf("no answer within the %s collect budget: %w", mc.collectBudget, context.DeadlineExceeded))
+	defer cancel()
+
+	// Node enrichment makes its own Talos calls per node, each within sourceTimeout
+	nodesCh := start(ctx, mc.collectBudget, mc.collectNodes)
+	k8sCh := start(ctx, mc.sourceTimeout, mc.k8sClient.GetKubernetesStatus)
+	appsCh := start(ctx, mc.sourceTimeout, mc.k8sClient.GetApplicationStatus)
+	fluxCh := start(ctx, mc.sourceTimeout, mc.k8sClient.GetFluxStatus)
+	talosCh := start(ctx, mc.sourceTimeout, mc.talosClient.GetTalosStatus)
+	inventoryCh := start(ctx, mc.sourceTimeout, mc.talosClient.GetTalosInventory)
+	etcdCh := start(ctx, mc.sourceTimeout, mc.talosClient.GetEtcdStatus)
+
+	metrics := &ClusterMetrics{
+		Sections:  make(map[string]SectionStatus),
+		UpdatedAt: time.Now(),
 	}
 
-	k8sStatus, err := mc.k8sClient.GetKubernetesStatus(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get k8s status: %w", err)
+	nodes, err := await(ctx, nodesCh)
+	metrics.Hardware = hardwareStatus(nodes)
+	settle(metrics, last, SectionHardware, err, func(last *ClusterMetrics) { metrics.Hardware = last.Hardware })
+
+	k8sStatus, err := await(ctx, k8sCh)
+	if err == nil {
+		metrics.Kubernetes = *k8sStatus
 	}
-	metrics.Kubernetes = *k8sStatus
+	settle(metrics, last, SectionKubernetes, err, func(last *ClusterMetrics) { metrics.Kubernetes = last.Kubernetes })
 
-	apps, err := mc.k8sClient.GetApplicationStatus(ctx)
+	apps, err := await(ctx, appsCh)
+	metrics.Applications = apps
 	if err != nil {
-		return nil, fmt.Errorf("failed to get app status: %w", err)
+		metrics.Applications = []AppStatus{}
 	}
-	metrics.Applications = apps
+	settle(metrics, last, SectionApplications, err, func(last *ClusterMetrics) { metrics.Applications = last.Applications })
 
 	// Collect Flux status
-	fluxStatus, err := mc.k8sClient.GetFluxStatus(ctx)
+	fluxStatus, err := await(ctx, fluxCh)
 	if err != nil {
 		// Flux might not be installed, don't fail completely
 		metrics.Flux = FluxStatus{
 			Version:        "Not Installed",
+			Controllers:    []FluxController{},
 			GitRepository:  "N/A",
 			LastSync:       "N/A",
+			Sources:        []FluxSource{},
 			Kustomizations: []FluxResource{},
 			HelmReleases:   []FluxResource{},
+			RecentActivity: []FluxEvent{},
 			Healthy:        false,
 		}
 	} else {
 		metrics.Flux = *fluxStatus
 	}
+	settle(metrics, last, SectionFlux, err, func(last *ClusterMetrics) { metrics.Flux = last.Flux })
+
+	// Collect Talos metrics
+	talosStatus, err := await(ctx, talosCh)
+	if err != nil {
+		// Talos might not be accessible, don't fail completely
+		metrics.Talos = TalosStatus{
+			Version:       "Unknown",
+			ClusterHealth: "Unavailable",
+			Services:      make(map[string]string),
+			Nodes:         []TalosNode{},
+			Healthy:       false,
+			Error:         err.Error(),
+		}
+	} else {
+		metrics.Talos = *talosStatus
+	}
+	settle(metrics, last, SectionTalos, err, func(last *ClusterMetrics) { metrics.Talos = last.Talos })
+
+	// Probe the Talos inventory independently of Kubernetes to find nodes that never joined
+	inventory, err := await(ctx, inventoryCh)
+	if err != nil {
+		metrics.Talos.Inventory = TalosInventory{
+			Endpoints:      []TalosEndpoint{},
+			KubernetesOnly: []string{},
+			Warnings:       []string{},
+		}
+	} else {
+		// Without any nodes every endpoint would be reported as not joined
+		if metrics.Sections[SectionHardware].State != SectionUnavailable {
+			reconcileInventory(inventory, metrics.Hardware.NodeDetails)
+		}
+		metrics.Talos.Inventory = *inventory
+	}
+	settle(metrics, last, SectionInventory, err, func(last *ClusterMetrics) { metrics.Talos.Inventory = last.Talos.Inventory })
+
+	// Collect etcd status through Talos
+	etcdStatus, err := await(ctx, etcdCh)
+	if err != nil {
+		metrics.Etcd = EtcdStatus{
+			Members:  []EtcdMember{},
+			Alarms:   []EtcdAlarm{},
+			Warnings: []string{},
+			Healthy:  false,
+			Error:    err.Error(),
+		}
+	} else {
+		metrics.Etcd = *etcdStatus
+	}
+	settle(metrics, last, SectionEtcd, err, func(last *ClusterMetrics) { metrics.Etcd = last.Etcd })
+
+	return metrics
+}
 
-	// Build hardware status
+// result is what one source returned
+type result[T any] struct {
+	value T
+	err   error
+}
+
+// start queries a source in its own goroutine, bounded by timeout
+func start[T any](ctx context.Context, timeout time.Duration, fetch func(context.Context) (T, error)) <-chan result[T] {
+	ch := make(chan result[T], 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		value, err := fetch(ctx)
+		if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			err = fmt.Errorf("no answer within %s: %w", timeout, err)
+		}
+		ch <- result[T]{value: value, err: err}
+	}()
+	return ch
+}
+
+// await waits for a source until the collect budget runs out. A source that
+// does not return by then is abandoned; its goroutine ends on its own.
+func await[T any](ctx context.Context, ch <-chan result[T]) (T, error) {
+	// Sources are awaited in turn, so take one that already answered even when the budget is spent
+	select {
+	case r := <-ch:
+		return r.value, r.err
+	default:
+	}
+
+	select {
+	case r := <-ch:
+		return r.value, r.err
+	case <-ctx.Done():
+		var zero T
+		return zero, context.Cause(ctx)
+	}
+}
+
+// settle records how a section was collected. When err is set the section
+// falls back to the last collect that had data for it, marked stale and
+// keeping that collect's time; without one it is marked unavailable and keeps
+// the empty value already set.
+func settle(metrics, last *ClusterMetrics, section string, err error, keepLast func(last *ClusterMetrics)) {
+	if err == nil {
+		metrics.Sections[section] = SectionStatus{State: SectionFresh, UpdatedAt: metrics.UpdatedAt}
+		return
+	}
+
+	status := SectionStatus{State: SectionUnavailable, Error: err.Error()}
+	if last != nil {
+		if previous := last.Sections[section]; previous.State == SectionFresh || previous.State == SectionStale {
+			keepLast(last)
+			status.State = SectionStale
+			status.UpdatedAt = previous.UpdatedAt
+		}
+	}
+	metrics.Sections[section] = status
+}
+
+// collectNodes lists the nodes and enriches them with thermal, power, storage,
+// disk I/O, network and config drift data from Talos. Every node and every
+// source runs in its own goroutine with its own timeout, so one unreachable
+// node or slow call only leaves its own fields unset.
+func (mc *MetricsCollector) collectNodes(ctx context.Context) ([]NodeDetail, error) {
+	listCtx, cancel := context.WithTimeout(ctx, mc.sourceTimeout)
+	defer cancel()
+	nodes, err := mc.k8sClient.GetNodeMetrics(listCtx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get node metrics: %w", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := range nodes {
+		node := &nodes[i]
+		for _, chain := range [][]func(context.Context, *NodeDetail){
+			{mc.collectThermals, mc.collectPower}, // Power is judged against the thermals
+			{mc.collectStorage},
+			{mc.collectDiskIO},
+			{mc.collectNetwork},
+			{mc.collectConfigDrift},
+		} {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for _, collect := range chain {
+					callCtx, cancel := context.WithTimeout(ctx, mc.sourceTimeout)
+					collect(callCtx, node)
+					cancel()
+				}
+			}()
+		}
+	}
+	wg.Wait()
+
+	return nodes, nil
+}
+
+// hardwareStatus summarizes the nodes. Nodes that could not be listed count as not ready.
+func hardwareStatus(nodes []NodeDetail) HardwareStatus {
 	controlPlanes := 0
 	workers := 0
-	allReady := true
+	allReady := len(nodes) > 0
 	for _, node := range nodes {
 		if node.Role == "control-plane" {
 			controlPlanes++
@@ -209,35 +612,346 @@ func (mc *MetricsCollector) Collect(ctx context.Context) (*ClusterMetrics, error
 			allReady = false
 		}
 	}
+	if nodes == nil {
+		nodes = []NodeDetail{}
+	}
 
-	metrics.Hardware = HardwareStatus{
+	return HardwareStatus{
 		NodeCount:     len(nodes),
 		ControlPlanes: controlPlanes,
 		Workers:       workers,
 		TotalCPU:      "4x ARM Cortex-A72 (16 cores total)",
 		TotalMemory:   "32GB (4x 8GB)",
-		Storage:       "1TB External SSD",
+		Storage:       storageSummary(nodes),
 		AllNodesReady: allReady,
 		NodeDetails:   nodes,
 	}
+}
 
-	// Collect Talos metrics
-	talosStatus, err := mc.talosClient.GetTalosStatus(ctx)
+// collectThermals fills a node's thermal fields. Temperature is only set when
+// TemperatureStatus is TemperatureOK, so a failed read never shows as 0°C.
+func (mc *MetricsCollector) collectThermals(ctx context.Context, node *NodeDetail) {
+	node.ThermalZones = []ThermalZone{}
+	node.CoolingDevices = []CoolingDevice{}
+
+	if node.IP == "" {
+		node.TemperatureStatus = TemperatureUnavailable
+		node.TemperatureError = "node has no InternalIP"
+		return
+	}
+
+	thermals, err := mc.talosClient.GetNodeThermals(ctx, node.IP)
 	if err != nil {
-		// Talos might not be accessible, don't fail completely
-		metrics.Talos = TalosStatus{
-			Version:       "Unknown",
-			ClusterHealth: "Unknown",
-			Services:      make(map[string]string),
-			Healthy:       false,
+		node.TemperatureStatus = TemperatureUnreachable
+		if errors.Is(err, ErrTalosUnavailable) {
+			node.TemperatureStatus = TemperatureUnavailable
 		}
-	} else {
-		metrics.Talos = *talosStatus
+		node.TemperatureError = err.Error()
+		return
+	}
+	node.ThermalZones = thermals.Zones
+	node.CoolingDevices = thermals.CoolingDevices
+
+	if len(thermals.Zones) == 0 {
+		node.TemperatureStatus = TemperatureNoSensors
+		return
+	}
+
+	// Report the CPU zone when there is one, otherwise the hottest zone
+	var errs []string
+	found := false
+	for _, zone := range thermals.Zones {
+		if zone.Error != "" {
+			errs = append(errs, fmt.Sprintf("%s: %s", zone.Name, zone.Error))
+			continue
+		}
+		isCPU := strings.Contains(zone.Type, "cpu")
+		if !found || isCPU || zone.Temperature > node.Temperature {
+			node.Temperature = zone.Temperature
+			found = true
+			if isCPU {
+				break
+			}
+		}
+	}
+	node.TemperatureError = strings.Join(errs, "; ")
+	node.TemperatureStatus = TemperatureReadError
+	if found {
+		node.TemperatureStatus = TemperatureOK
+	}
+}
+
+// collectPower fills a node's power record. It runs after collectThermals
+// because throttling and the fan are judged against the node's thermals.
+func (mc *MetricsCollector) collectPower(ctx context.Context, node *NodeDetail) {
+	unavailable := func(reason string) {
+		node.Power = NodePower{
+			Status:     PowerUnavailable,
+			TripPoints: []TripPoint{},
+			Warnings:   []string{},
+			Error:      reason,
+		}
+	}
+
+	if node.IP == "" {
+		unavailable("node has no InternalIP")
+		return
+	}
+	power, err := mc.talosClient.GetNodePower(ctx, node.IP)
+	if err != nil {
+		unavailable(err.Error())
+		return
+	}
+
+	judgePower(power, node)
+	node.Power = *power
+}
+
+// judgePower derives throttling from the cpufreq cooling device and policy
+// limit, checks the PoE HAT fan and sets the status and warnings
+func judgePower(power *NodePower, node *NodeDetail) {
+	if power.CPUFreqLimitMHz > 0 && power.CPUFreqLimitMHz < power.CPUMaxFreqMHz {
+		power.FreqCapped = true
+	}
+	for _, device := range node.CoolingDevices {
+		if strings.HasPrefix(device.Type, "cpufreq") && device.CurState > 0 {
+			power.Throttled = true
+		}
+	}
+
+	switch {
+	case power.UnderVoltage:
+		power.Warnings = append(power.Warnings, "under-voltage now: the PoE supply is not keeping up")
+	case power.UnderVoltageOccurred:
+		power.Warnings = append(power.Warnings, "under-voltage occurred since boot")
+	}
+	switch {
+	case power.Throttled || power.FreqCapped || power.SoftTempLimit:
+		power.Warnings = append(power.Warnings, fmt.Sprintf("CPU throttled: %d of %d MHz allowed", power.CPUFreqLimitMHz, power.CPUMaxFreqMHz))
+	case power.ThrottledOccurred || power.FreqCappedOccurred || power.SoftTempLimitOccurred:
+		power.Warnings = append(power.Warnings, "CPU throttling occurred since boot")
+	}
+
+	power.Fan = poeFan(power, node)
+	if fan := power.Fan; fan != nil {
+		if fan.State < fan.ExpectedMin {
+			power.Warnings = append(power.Warnings, fmt.Sprintf("fan at state %d/%d but %.1f°C calls for at least %d", fan.State, fan.MaxState, node.Temperature, fan.ExpectedMin))
+		}
+		if !fan.MatchesConfig {
+			power.Warnings = append(power.Warnings, "fan trip points differ from raspberrypi/rpi_poe.yaml")
+		}
+	}
+
+	switch {
+	case power.UnderVoltage || power.Throttled || power.FreqCapped || power.SoftTempLimit:
+		power.Status = PowerThrottled
+	case len(power.Warnings) > 0:
+		power.Status = PowerWarning
+	default:
+		power.Status = PowerOK
+	}
+}
+
+// poeFan finds the PoE HAT fan and works out which states the CPU zone's
+// active trip points allow at the current temperature
+func poeFan(power *NodePower, node *NodeDetail) *FanStatus {
+	var device *CoolingDevice
+	for i := range node.CoolingDevices {
+		if t := node.CoolingDevices[i].Type; strings.Contains(t, "poe") || t == "pwm-fan" {
+			device = &node.CoolingDevices[i]
+			break
+		}
+	}
+	if device == nil || device.Error != "" {
+		return nil
+	}
+
+	var trips []TripPoint
+	for _, trip := range power.TripPoints {
+		if trip.Type == "active" {
+			trips = append(trips, trip)
+		}
+	}
+
+	fan := &FanStatus{
+		Device:        device.Type,
+		State:         device.CurState,
+		MaxState:      device.MaxState,
+		MatchesConfig: len(trips) == len(PoEFanTrips),
+	}
+	for i, trip := range trips {
+		if node.TemperatureStatus == TemperatureOK {
+			if node.Temperature >= trip.Temperature {
+				fan.ExpectedMin++
+			}
+			if node.Temperature > trip.Temperature-trip.Hysteresis {
+				fan.ExpectedMax++
+			}
+		}
+		if i < len(PoEFanTrips) && int64(math.Round(trip.Temperature*1000)) != PoEFanTrips[i] {
+			fan.MatchesConfig = false
+		}
+	}
+	return fan
+}
+
+// collectStorage fills a node's disk inventory and mount usage
+func (mc *MetricsCollector) collectStorage(ctx context.Context, node *NodeDetail) {
+	node.Storage = NodeStorage{
+		Disks:    []Disk{},
+		Mounts:   []MountUsage{},
+		Warnings: []string{},
+	}
+
+	if node.IP == "" {
+		node.Storage.Error = "node has no InternalIP"
+		return
+	}
+	storage, err := mc.talosClient.GetNodeStorage(ctx, node.IP)
+	if err != nil {
+		node.Storage.Error = err.Error()
+		return
+	}
+	node.Storage = *storage
+}
+
+// collectDiskIO fills a node's latest block device sample
+func (mc *MetricsCollector) collectDiskIO(ctx context.Context, node *NodeDetail) {
+	node.DiskIO = NodeDiskIO{Devices: []DiskIO{}}
+
+	if node.IP == "" {
+		node.DiskIO.Error = "node has no InternalIP"
+		return
 	}
+	diskIO, err := mc.talosClient.GetNodeDiskIO(ctx, node.IP)
+	if err != nil {
+		node.DiskIO.Error = err.Error()
+		return
+	}
+	node.DiskIO = *diskIO
+}
+
+// collectNetwork fills a node's interfaces and link warnings
+func (mc *MetricsCollector) collectNetwork(ctx context.Context, node *NodeDetail) {
+	node.Network = NodeNetwork{
+		Interfaces: []NetInterface{},
+		Warnings:   []string{},
+	}
+
+	if node.IP == "" {
+		node.Network.Error = "node has no InternalIP"
+		return
+	}
+	network, err := mc.talosClient.GetNodeNetwork(ctx, node.IP, node.Name)
+	if err != nil {
+		node.Network.Error = err.Error()
+		return
+	}
+	node.Network = *network
+}
 
-	// Cache the results
-	mc.cache = metrics
-	mc.cacheExpiry = time.Now().Add(mc.cacheTTL)
+// collectConfigDrift compares a node's running machine config with the expected patches
+func (mc *MetricsCollector) collectConfigDrift(ctx context.Context, node *NodeDetail) {
+	node.ConfigDrift = NodeConfigDrift{
+		Status:  DriftUnknown,
+		Checked: []string{},
+		Diffs:   []ConfigDiff{},
+	}
 
-	return metrics, nil
+	if node.IP == "" {
+		node.ConfigDrift.Error = "node has no InternalIP"
+		return
+	}
+	drift, err := mc.talosClient.GetNodeConfigDrift(ctx, node.IP, node.Name)
+	if err != nil {
+		node.ConfigDrift.Error = err.Error()
+		return
+	}
+	node.ConfigDrift = *drift
+}
+
+// storageSummary describes the cluster's disks grouped by transport and size,
+// e.g. "3x 931.5 GiB usb, 4x 29.7 GiB mmc"
+func storageSummary(nodes []NodeDetail) string {
+	type group struct {
+		transport string
+		size      uint64
+	}
+	counts := make(map[group]int)
+	var order []group
+	for _, node := range nodes {
+		for _, disk := range node.Storage.Disks {
+			transport := disk.Transport
+			if transport == "" {
+				transport = "disk"
+			}
+			// Round to 0.1 GiB so identical models with slightly different capacities group together
+			g := group{transport: transport, size: disk.Size / (1 << 30 / 10)}
+			if counts[g] == 0 {
+				order = append(order, g)
+			}
+			counts[g]++
+		}
+	}
+	if len(order) == 0 {
+		return "Unknown"
+	}
+
+	sort.SliceStable(order, func(i, j int) bool { return order[i].size > order[j].size })
+	parts := make([]string, 0, len(order))
+	for _, g := range order {
+		parts = append(parts, fmt.Sprintf("%dx %.1f GiB %s", counts[g], float64(g.size)/10, g.transport))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// reconcileInventory matches Talos endpoints with Kubernetes nodes by address or
+// hostname and warns about nodes that are only on one side or not running
+func reconcileInventory(inventory *TalosInventory, nodes []NodeDetail) {
+	matched := make(map[string]bool, len(nodes))
+	for i := range inventory.Endpoints {
+		endpoint := &inventory.Endpoints[i]
+		for _, node := range nodes {
+			if node.IP == endpoint.Address || (endpoint.Hostname != "" && node.Name == endpoint.Hostname) ||
+				(endpoint.ExpectedHostname != "" && node.Name == endpoint.ExpectedHostname) {
+				endpoint.KubernetesNode = node.Name
+				matched[node.Name] = true
+				break
+			}
+		}
+
+		name := endpoint.Address
+		if hostname := firstNonEmpty(endpoint.Hostname, endpoint.ExpectedHostname); hostname != "" {
+			name = fmt.Sprintf("%s (%s)", hostname, endpoint.Address)
+		}
+		switch {
+		case endpoint.Mode == TalosModeDown && endpoint.KubernetesNode == "":
+			inventory.Warnings = append(inventory.Warnings, fmt.Sprintf("%s is not reachable on the Talos API and is not a Kubernetes node", name))
+		case endpoint.Mode == TalosModeDown:
+			inventory.Warnings = append(inventory.Warnings, fmt.Sprintf("%s is not reachable on the Talos API", name))
+		case endpoint.Mode == TalosModeMaintenance:
+			inventory.Warnings = append(inventory.Warnings, fmt.Sprintf("%s is in maintenance mode: it has no machine config applied", name))
+		case endpoint.KubernetesNode == "":
+			inventory.Warnings = append(inventory.Warnings, fmt.Sprintf("%s runs Talos (%s) but has not joined Kubernetes", name, endpoint.Stage))
+		case endpoint.Stage != "running":
+			inventory.Warnings = append(inventory.Warnings, fmt.Sprintf("%s is %s", name, endpoint.Stage))
+		}
+	}
+
+	for _, node := range nodes {
+		if !matched[node.Name] {
+			inventory.KubernetesOnly = append(inventory.KubernetesOnly, node.Name)
+			inventory.Warnings = append(inventory.Warnings, fmt.Sprintf("Kubernetes node %s is not in the Talos inventory", node.Name))
+		}
+	}
+}
+
+// firstNonEmpty returns the first of its arguments that is not empty
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
 }
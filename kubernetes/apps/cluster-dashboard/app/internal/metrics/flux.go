@@ -0,0 +1,89 @@
+package metrics
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned when a requested object does not exist in the cluster
+var ErrNotFound = errors.New("not found")
+
+// Condition is a status condition as shown on detail pages
+type Condition struct {
+	Type               string    `json:"type"`
+	Status             string    `json:"status"` // True, False or Unknown
+	Reason             string    `json:"reason"`
+	Message            string    `json:"message"`
+	LastTransitionTime time.Time `json:"last_transition_time"`
+}
+
+// HelmReleaseDetail is the drill-down view of a single HelmRelease
+type HelmReleaseDetail struct {
+	Name                  string                `json:"name"`
+	Namespace             string                `json:"namespace"`
+	Chart                 string                `json:"chart"`
+	ChartVersion          string                `json:"chart_version"`
+	Source                string                `json:"source"` // kind/namespace/name of the chart source
+	Suspended             bool                  `json:"suspended"`
+	LastAttemptedRevision string                `json:"last_attempted_revision"`
+	InstallFailures       int64                 `json:"install_failures"`
+	UpgradeFailures       int64                 `json:"upgrade_failures"`
+	Failures              int64                 `json:"failures"`
+	Conditions            []Condition           `json:"conditions"` // Ready, Released, TestSuccess, Remediated
+	History               []HelmReleaseSnapshot `json:"history"`    // Newest first
+	ValuesFrom            []string              `json:"values_from"`
+	Values                string                `json:"values"` // Effective values as YAML, Secret data left out
+	ValuesErrors          []string              `json:"values_errors,omitempty"`
+	ValuesIncomplete      []string              `json:"values_incomplete,omitempty"` // Secret values files missing from Values
+}
+
+// HelmReleaseSnapshot is one entry of a HelmRelease's status.history
+type HelmReleaseSnapshot struct {
+	Version       int64     `json:"version"`
+	Status        string    `json:"status"`
+	ChartName     string    `json:"chart_name"`
+	ChartVersion  string    `json:"chart_version"`
+	AppVersion    string    `json:"app_version"`
+	Digest        string    `json:"digest"`
+	ConfigDigest  string    `json:"config_digest"`
+	FirstDeployed time.Time `json:"first_deployed"`
+	LastDeployed  time.Time `json:"last_deployed"`
+}
+
+// KustomizationInventory is the drill-down view of everything a Kustomization applied
+type KustomizationInventory struct {
+	Name       string               `json:"name"`
+	Namespace  string               `json:"namespace"`
+	Revision   string               `json:"revision"`
+	Ready      bool                 `json:"ready"`
+	Status     string               `json:"status"`
+	Total      int                  `json:"total"`
+	Healthy    int                  `json:"healthy"`
+	Unhealthy  int                  `json:"unhealthy"`
+	Missing    int                  `json:"missing"`
+	Unknown    int                  `json:"unknown"`    // Unreadable objects and unrecognised inventory ids
+	Namespaces []InventoryNamespace `json:"namespaces"` // Cluster-scoped objects use an empty namespace
+}
+
+// InventoryNamespace groups inventory objects in one namespace by kind
+type InventoryNamespace struct {
+	Namespace string          `json:"namespace"`
+	Kinds     []InventoryKind `json:"kinds"`
+}
+
+// InventoryKind groups inventory objects of one kind
+type InventoryKind struct {
+	Kind    string            `json:"kind"`
+	Objects []InventoryObject `json:"objects"`
+}
+
+// InventoryObject is one object from status.inventory.entries with its live health
+type InventoryObject struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	Group     string `json:"group"`
+	Version   string `json:"version"`
+	Kind      string `json:"kind"`
+	Health    string `json:"health"` // Healthy, Progressing, Unhealthy, Missing or Unknown
+	Message   string `json:"message,omitempty"`
+}
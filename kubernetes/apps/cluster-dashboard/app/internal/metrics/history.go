@@ -0,0 +1,49 @@
+package metrics
+
+import "time"
+
+// Metrics kept in the history. CPU and memory are recorded per node and as
+// the cluster averages of KubernetesStatus, temperature per node only.
+const (
+	HistoryCPU         = "cpu"         // Percent
+	HistoryMemory      = "memory"      // Percent
+	HistoryTemperature = "temperature" // °C
+)
+
+// HistorySeries is the history of one metric at one resolution, oldest first
+type HistorySeries struct {
+	Metric     string         `json:"metric"`
+	Node       string         `json:"node,omitempty"` // Empty for the cluster average
+	Resolution string         `json:"resolution"`     // Bucket width: 1m, 5m or 1h
+	Points     []HistoryPoint `json:"points"`
+}
+
+// HistoryPoint is one bucket of a series, aggregating every sample collected in it
+type HistoryPoint struct {
+	Time    time.Time `json:"time"` // Start of the bucket
+	Avg     float64   `json:"avg"`
+	Min     float64   `json:"min"`
+	Max     float64   `json:"max"`
+	Samples int       `json:"samples"`
+}
+
+// StateTransition is a change of state seen between two collects
+type StateTransition struct {
+	Time time.Time `json:"time"`
+	Kind string    `json:"kind"` // node, talos, section, kustomization, helmrelease or application
+	Name string    `json:"name"`
+	From string    `json:"from"`
+	To   string    `json:"to"`
+}
+
+// ClusterEvent is a Kubernetes Warning event
+type ClusterEvent struct {
+	UID       string    `json:"uid"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	Count     int32     `json:"count"`
+	Namespace string    `json:"namespace"`
+	Object    string    `json:"object"` // Kind/name of the involved object
+	Reason    string    `json:"reason"`
+	Message   string    `json:"message"`
+}
@@ -0,0 +1,20 @@
+package metrics
+
+// DrainPlan is what draining a node would do. It is worked out from the cluster
+// on every request, so while a drain runs it shows the pods still to go.
+type DrainPlan struct {
+	Node      string     `json:"node"`
+	Cordoned  bool       `json:"cordoned"`
+	Evict     []DrainPod `json:"evict"`     // Pods a drain evicts
+	Unmanaged []DrainPod `json:"unmanaged"` // Pods without a controller; the drain refuses to run while there are any
+	Skipped   []DrainPod `json:"skipped"`   // DaemonSet, static and finished pods, left where they are
+}
+
+// DrainPod is one pod on a node being drained
+type DrainPod struct {
+	Namespace   string `json:"namespace"`
+	Name        string `json:"name"`
+	Owner       string `json:"owner"` // Kind/name of the controller, empty for unmanaged pods
+	Terminating bool   `json:"terminating"`
+	BlockedBy   string `json:"blocked_by,omitempty"` // PodDisruptionBudget that allows no disruption right now
+}
@@ -0,0 +1,314 @@
+package metrics
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrTalosUnavailable is returned by Talos calls when the client has no usable talosconfig
+var ErrTalosUnavailable = errors.New("talos api unavailable")
+
+// ErrTalosNoElevatedConfig is returned by Talos calls that need more than the
+// os:reader role when no elevated talosconfig is mounted
+var ErrTalosNoElevatedConfig = errors.New("no elevated talosconfig")
+
+// KernelLog is the log source for the kernel ring buffer, like `talosctl dmesg`
+const KernelLog = "kernel"
+
+// LogSources are the logs the node log viewer streams: Talos services, like
+// `talosctl logs <service>`, and the kernel ring buffer
+var LogSources = []string{"kubelet", "etcd", "containerd", "apid", "machined", KernelLog}
+
+// Temperature states reported on NodeDetail. Only TemperatureOK carries a real reading.
+const (
+	TemperatureOK          = "OK"
+	TemperatureUnavailable = "Unavailable" // Talos API not configured or node has no IP
+	TemperatureUnreachable = "Unreachable" // The node's thermal sysfs could not be listed
+	TemperatureNoSensors   = "No sensors"  // The node exposes no thermal zones
+	TemperatureReadError   = "Read error"  // No thermal zone could be read
+)
+
+// NodeThermals holds every thermal zone and cooling device of one node
+type NodeThermals struct {
+	Zones          []ThermalZone   `json:"zones"`
+	CoolingDevices []CoolingDevice `json:"cooling_devices"`
+}
+
+// ThermalZone is one /sys/class/thermal/thermal_zone* sensor
+type ThermalZone struct {
+	Name        string  `json:"name"` // thermal_zone0, ...
+	Type        string  `json:"type"` // cpu-thermal, ...
+	Temperature float64 `json:"temperature"`
+	Error       string  `json:"error,omitempty"`
+}
+
+// CoolingDevice is one /sys/class/thermal/cooling_device* (e.g. the PoE HAT fan)
+type CoolingDevice struct {
+	Name     string `json:"name"` // cooling_device0, ...
+	Type     string `json:"type"` // rpi-poe-fan, pwm-fan, ...
+	CurState int    `json:"cur_state"`
+	MaxState int    `json:"max_state"`
+	Error    string `json:"error,omitempty"`
+}
+
+// EtcdStatus represents the etcd cluster behind the control plane
+type EtcdStatus struct {
+	Members    []EtcdMember `json:"members"`
+	Leader     string       `json:"leader"` // Hostname of the leader, empty when there is none
+	RaftTerm   uint64       `json:"raft_term"`
+	QuotaBytes int64        `json:"quota_bytes"` // Backend quota the DB size is measured against
+	Alarms     []EtcdAlarm  `json:"alarms"`
+	Warnings   []string     `json:"warnings"`
+	Healthy    bool         `json:"healthy"`
+	Error      string       `json:"error,omitempty"` // Why etcd could not be queried
+}
+
+// EtcdMember is one etcd member with the status it reports
+type EtcdMember struct {
+	ID               string   `json:"id"` // Hex member ID as shown by talosctl
+	Hostname         string   `json:"hostname"`
+	Node             string   `json:"node"` // Address the status was queried at
+	PeerURLs         []string `json:"peer_urls"`
+	ClientURLs       []string `json:"client_urls"`
+	IsLearner        bool     `json:"is_learner"`
+	IsLeader         bool     `json:"is_leader"`
+	ProtocolVersion  string   `json:"protocol_version"`
+	RaftTerm         uint64   `json:"raft_term"`
+	RaftIndex        uint64   `json:"raft_index"`
+	RaftAppliedIndex uint64   `json:"raft_applied_index"`
+	DBSize           int64    `json:"db_size"`
+	DBSizeInUse      int64    `json:"db_size_in_use"`
+	QuotaPercent     float64  `json:"quota_percent"` // DBSize as a percentage of the quota
+	Lagging          bool     `json:"lagging"`
+	Errors           []string `json:"errors,omitempty"` // Errors reported by the member itself
+	Error            string   `json:"error,omitempty"`  // Why the status could not be read
+}
+
+// EtcdAlarm is an active alarm raised by an etcd member
+type EtcdAlarm struct {
+	MemberID string `json:"member_id"`
+	Member   string `json:"member"` // Hostname of the member
+	Alarm    string `json:"alarm"`  // NOSPACE or CORRUPT
+}
+
+// Power states reported on NodePower
+const (
+	PowerOK          = "OK"
+	PowerThrottled   = "Throttled"   // Throttling, frequency capping or under-voltage right now
+	PowerWarning     = "Warning"     // Throttled since boot, or the fan is behind its trip points
+	PowerUnavailable = "Unavailable" // Nothing could be read from the node
+)
+
+// PoEFanTrips are the PoE HAT fan trip temperatures in millidegrees Celsius set by
+// the dtparams in raspberrypi/rpi_poe.yaml. Nodes reporting other trips are flagged.
+var PoEFanTrips = []int64{65000, 70000, 75000, 80000}
+
+// NodePower is the power and thermal health of a Raspberry Pi node
+type NodePower struct {
+	Status          string `json:"status"` // One of the Power* states
+	CPUFreqMHz      int64  `json:"cpu_freq_mhz"`
+	CPUMaxFreqMHz   int64  `json:"cpu_max_freq_mhz"`   // Hardware maximum
+	CPUFreqLimitMHz int64  `json:"cpu_freq_limit_mhz"` // Current policy limit, lowered by thermal capping
+
+	// Firmware throttle flags. ThrottledFlags is the raw get_throttled bitmask and
+	// is empty when the kernel does not expose it; UnderVoltage may still come from hwmon.
+	ThrottledFlags        string `json:"throttled_flags,omitempty"`
+	UnderVoltage          bool   `json:"under_voltage"`
+	UnderVoltageOccurred  bool   `json:"under_voltage_occurred"`
+	FreqCapped            bool   `json:"freq_capped"`
+	FreqCappedOccurred    bool   `json:"freq_capped_occurred"`
+	Throttled             bool   `json:"throttled"`
+	ThrottledOccurred     bool   `json:"throttled_occurred"`
+	SoftTempLimit         bool   `json:"soft_temp_limit"`
+	SoftTempLimitOccurred bool   `json:"soft_temp_limit_occurred"`
+
+	TripPoints []TripPoint `json:"trip_points"` // Trip points of the CPU thermal zone
+	Fan        *FanStatus  `json:"fan,omitempty"`
+	Warnings   []string    `json:"warnings"`
+	Error      string      `json:"error,omitempty"`
+}
+
+// TripPoint is one trip point of a thermal zone
+type TripPoint struct {
+	Type        string  `json:"type"` // active, passive, hot or critical
+	Temperature float64 `json:"temperature"`
+	Hysteresis  float64 `json:"hysteresis"`
+}
+
+// FanStatus compares the PoE HAT fan's state with what its trip points call for
+type FanStatus struct {
+	Device        string `json:"device"`
+	State         int    `json:"state"`
+	MaxState      int    `json:"max_state"`
+	ExpectedMin   int    `json:"expected_min"` // Lowest state the current temperature allows
+	ExpectedMax   int    `json:"expected_max"` // Highest state, allowing for hysteresis
+	MatchesConfig bool   `json:"matches_config"`
+}
+
+// NodeStorage is the disk inventory and filesystem usage of one node
+type NodeStorage struct {
+	Disks    []Disk       `json:"disks"`
+	Mounts   []MountUsage `json:"mounts"` // Only the watched mount points present on the node
+	Warnings []string     `json:"warnings"`
+	Error    string       `json:"error,omitempty"`
+}
+
+// Disk is one physical disk as discovered by Talos
+type Disk struct {
+	Name       string `json:"name"` // sda, mmcblk0, ...
+	DevPath    string `json:"dev_path"`
+	Model      string `json:"model"`
+	Serial     string `json:"serial,omitempty"`
+	Size       uint64 `json:"size"`
+	Transport  string `json:"transport"` // mmc, usb, nvme, ...
+	Rotational bool   `json:"rotational"`
+	System     bool   `json:"system"` // Talos is installed on this disk
+}
+
+// MountUsage is the capacity of one mounted filesystem
+type MountUsage struct {
+	MountPoint  string  `json:"mount_point"`
+	Filesystem  string  `json:"filesystem"` // Backing device
+	Size        uint64  `json:"size"`
+	Used        uint64  `json:"used"`
+	Available   uint64  `json:"available"`
+	UsedPercent float64 `json:"used_percent"`
+	Warning     bool    `json:"warning"` // UsedPercent is at or above the fill warning
+}
+
+// SD card wear states, judged on how long until the bytes-written rate uses up the endurance budget
+const (
+	WearOK       = "OK"
+	WearWarning  = "Warning"  // Budget reached within three years
+	WearCritical = "Critical" // Budget reached within a year
+)
+
+// NodeDiskIO holds the latest block device sample of one node
+type NodeDiskIO struct {
+	Devices   []DiskIO  `json:"devices"`
+	SampledAt time.Time `json:"sampled_at"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// DiskIO is the I/O of one block device from /sys/block/<dev>/stat. Rates cover
+// the last sampling interval; totals and the daily estimate cover the node's uptime.
+type DiskIO struct {
+	Name               string  `json:"name"`
+	ReadBytesPerSec    float64 `json:"read_bytes_per_sec"`
+	WriteBytesPerSec   float64 `json:"write_bytes_per_sec"`
+	ReadIOPS           float64 `json:"read_iops"`
+	WriteIOPS          float64 `json:"write_iops"`
+	BytesRead          uint64  `json:"bytes_read"`
+	BytesWritten       uint64  `json:"bytes_written"`
+	BytesWrittenPerDay float64 `json:"bytes_written_per_day"`
+	Wear               *SDWear `json:"wear,omitempty"` // SD and eMMC devices only
+}
+
+// SDWear estimates how long an SD card lasts at its current write rate
+type SDWear struct {
+	EnduranceBytes uint64  `json:"endurance_bytes"`     // Configured write budget
+	YearsToBudget  float64 `json:"years_to_budget"`     // At the current bytes-written-per-day rate
+	LifeTime       string  `json:"life_time,omitempty"` // eMMC life_time estimate, when the device exposes it
+	Status         string  `json:"status"`              // One of the Wear* states
+}
+
+// NodeNetwork is the link and address state of one node's physical interfaces
+type NodeNetwork struct {
+	Interfaces      []NetInterface `json:"interfaces"`
+	ExpectedAddress string         `json:"expected_address,omitempty"` // Static address the node was provisioned with
+	SampledAt       time.Time      `json:"sampled_at"`                 // Time of the last /proc/net/dev sample
+	SampleError     string         `json:"sample_error,omitempty"`     // Why counters are missing: not sampled yet or the read failed
+	Warnings        []string       `json:"warnings"`
+	Error           string         `json:"error,omitempty"`
+}
+
+// NetInterface is one physical network interface. Link state comes from Talos'
+// LinkStatus resources, counters from /proc/net/dev; rates and NewErrors cover
+// the last sampling interval. Counters are only meaningful when Sampled, and
+// rates and NewErrors only when Rated, which needs two samples.
+type NetInterface struct {
+	Name          string   `json:"name"` // end0, eth0, ...
+	MAC           string   `json:"mac"`
+	Up            bool     `json:"up"`         // Carrier detected
+	OperState     string   `json:"oper_state"` // up, down, lowerLayerDown, ...
+	SpeedMbps     int      `json:"speed_mbps"`
+	Duplex        string   `json:"duplex"` // Full, Half or Unknown
+	MTU           uint32   `json:"mtu"`
+	Addresses     []string `json:"addresses"` // CIDR notation
+	Sampled       bool     `json:"sampled"`   // Counters come from the last sample
+	Rated         bool     `json:"rated"`     // Rates cover the last interval
+	RxBytes       uint64   `json:"rx_bytes"`
+	TxBytes       uint64   `json:"tx_bytes"`
+	RxBytesPerSec float64  `json:"rx_bytes_per_sec"`
+	TxBytesPerSec float64  `json:"tx_bytes_per_sec"`
+	RxErrors      uint64   `json:"rx_errors"`
+	TxErrors      uint64   `json:"tx_errors"`
+	RxDropped     uint64   `json:"rx_dropped"`
+	TxDropped     uint64   `json:"tx_dropped"`
+	NewErrors     uint64   `json:"new_errors"` // Errors and drops, both directions
+}
+
+// VIPStatus shows which control-plane node holds the shared API server address
+type VIPStatus struct {
+	Address string    `json:"address"`
+	Holders []string  `json:"holders"` // Hostnames; exactly one when healthy
+	Moves   []VIPMove `json:"moves"`   // Most recent first
+	Warning string    `json:"warning,omitempty"`
+}
+
+// VIPMove is a change of VIP holder seen between two collections
+type VIPMove struct {
+	Time time.Time `json:"time"`
+	From string    `json:"from"` // "none" when no node held the VIP
+	To   string    `json:"to"`
+}
+
+// Config drift states reported on NodeConfigDrift
+const (
+	DriftInSync        = "In sync"
+	DriftDrifted       = "Drifted"
+	DriftUnknown       = "Unknown"        // The running config could not be read
+	DriftNotConfigured = "Not configured" // No expected config is mounted for the node
+)
+
+// NodeConfigDrift compares a node's running machine config with the expected patches
+type NodeConfigDrift struct {
+	Status  string       `json:"status"`  // One of the Drift* states
+	Checked []string     `json:"checked"` // Fields the expected patches set
+	Diffs   []ConfigDiff `json:"diffs"`
+	Error   string       `json:"error,omitempty"`
+}
+
+// ConfigDiff is one field whose running value differs from the expected one.
+// Values are YAML; an empty Actual means the field is not set on the node.
+type ConfigDiff struct {
+	Field    string `json:"field"` // e.g. machine.network.interfaces[end0].addresses
+	Expected string `json:"expected"`
+	Actual   string `json:"actual"`
+}
+
+// Talos API modes of an inventory endpoint
+const (
+	TalosModeSecure      = "secure"      // Answers with the cluster's talosconfig
+	TalosModeMaintenance = "maintenance" // Answers only insecurely: booted but never configured
+	TalosModeDown        = "down"        // Nothing answers on the Talos API port
+)
+
+// TalosInventory reconciles the configured Talos endpoints with the Kubernetes nodes
+type TalosInventory struct {
+	Endpoints      []TalosEndpoint `json:"endpoints"`
+	KubernetesOnly []string        `json:"kubernetes_only"` // Kubernetes nodes matching no endpoint
+	Warnings       []string        `json:"warnings"`
+}
+
+// TalosEndpoint is one configured Talos node as probed directly, independent of Kubernetes
+type TalosEndpoint struct {
+	Address          string `json:"address"`
+	ExpectedHostname string `json:"expected_hostname,omitempty"` // From the static address inventory
+	Hostname         string `json:"hostname,omitempty"`          // Reported by Talos
+	PortOpen         bool   `json:"port_open"`                   // apid accepts TCP connections
+	Mode             string `json:"mode"`                        // One of the TalosMode* values
+	Stage            string `json:"stage"`                       // booting, maintenance, running, upgrading, resetting, ...
+	KubernetesNode   string `json:"kubernetes_node,omitempty"`   // Matching node, empty when it never joined
+	Error            string `json:"error,omitempty"`
+}
@@ -0,0 +1,85 @@
+package metrics
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrLeaseHeld is returned when another replica holds the upgrade lease
+var ErrLeaseHeld = errors.New("upgrade lease held by another replica")
+
+// Upgrade run states
+const (
+	UpgradePlanned   = "Planned"   // Previewed, waiting to be started
+	UpgradeRunning   = "Running"   // Nodes are being upgraded
+	UpgradePaused    = "Paused"    // A step failed or the run was interrupted; resume retries it
+	UpgradeCompleted = "Completed" // Every node runs the target versions
+	UpgradeAborted   = "Aborted"
+)
+
+// Upgrade step phases, in the order a node goes through them. Kubernetes steps
+// skip cordon, drain and uncordon: their components restart in place.
+const (
+	PhasePending  = "Pending"
+	PhaseGate     = "Health gate"
+	PhaseCordon   = "Cordon"
+	PhaseDrain    = "Drain"
+	PhaseUpgrade  = "Upgrade"
+	PhaseRejoin   = "Wait for Ready"
+	PhaseUncordon = "Uncordon"
+	PhaseDone     = "Done"
+)
+
+// What an upgrade step upgrades. Kubernetes is upgraded in the order
+// talosctl upgrade-k8s uses: the control plane components node by node, then
+// kube-proxy, then the kubelet node by node, so no kubelet is newer than an API server.
+const (
+	ComponentTalos        = "Talos"
+	ComponentControlPlane = "Control plane"
+	ComponentKubeProxy    = "kube-proxy"
+	ComponentKubelet      = "Kubelet"
+)
+
+// UpgradeRun is a rolling Talos and/or Kubernetes upgrade: the targets and the
+// steps in the order they run. It is persisted so progress survives restarts
+// and is shared between replicas.
+type UpgradeRun struct {
+	ID                string         `json:"id"`
+	Image             string         `json:"image,omitempty"`              // Installer image, e.g. factory.talos.dev/installer/<schematic>:v1.11.6
+	TargetVersion     string         `json:"target_version,omitempty"`     // Tag of the image, compared with each node's Talos version
+	KubernetesVersion string         `json:"kubernetes_version,omitempty"` // Target Kubernetes version, e.g. v1.34.1
+	State             string         `json:"state"`                        // One of the Upgrade* states
+	Steps             []UpgradeStep  `json:"steps"`                        // Talos first, then Kubernetes; see UpgradeStep
+	Warnings          []string       `json:"warnings"`                     // Found while planning; they do not block the run
+	Message           string         `json:"message,omitempty"`
+	Owner             string         `json:"owner,omitempty"` // Replica running the upgrade
+	CreatedBy         string         `json:"created_by"`
+	CreatedAt         time.Time      `json:"created_at"`
+	StartedAt         time.Time      `json:"started_at"`
+	FinishedAt        time.Time      `json:"finished_at"`
+	Heartbeat         time.Time      `json:"heartbeat"` // Last write by the owner; ownership itself is a Lease
+	Events            []UpgradeEvent `json:"events"`    // Newest first
+}
+
+// UpgradeStep is the upgrade of one component on one node. Talos steps run
+// workers first, then control planes with the etcd leader last; Kubernetes
+// steps follow in the order of the Component* values.
+type UpgradeStep struct {
+	Component   string    `json:"component"` // One of the Component* values; empty in runs stored before Kubernetes upgrades, meaning Talos
+	Node        string    `json:"node"`      // Kubernetes node name, which is the Talos hostname; kube-proxy for its DaemonSet
+	IP          string    `json:"ip"`
+	Role        string    `json:"role"`
+	FromVersion string    `json:"from_version"`
+	Phase       string    `json:"phase"` // One of the Phase* values
+	Failed      bool      `json:"failed"`
+	Message     string    `json:"message,omitempty"`
+	StartedAt   time.Time `json:"started_at"`
+	FinishedAt  time.Time `json:"finished_at"`
+}
+
+// UpgradeEvent is one line of a run's progress log
+type UpgradeEvent struct {
+	Time    time.Time `json:"time"`
+	Node    string    `json:"node,omitempty"`
+	Message string    `json:"message"`
+}
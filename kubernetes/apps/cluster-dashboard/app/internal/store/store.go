@@ -0,0 +1,398 @@
+package store
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/pi-cluster/cluster-dashboard/internal/history"
+	"github.com/pi-cluster/cluster-dashboard/internal/metrics"
+)
+
+// Store limits. Together with the retention they bound the size of the file.
+const (
+	openTimeout     = 5 * time.Second // Another replica holding the file fails the open instead of hanging
+	expireInterval  = time.Hour
+	maxTransitions  = 5000
+	maxEvents       = 5000
+	compactMinSize  = 1 << 20 // Smaller files are never rewritten
+	compactMaxBlank = 0.5     // Share of free pages above which the file is rewritten on open
+)
+
+// Buckets of the database
+var (
+	metricsBucket     = []byte("metrics")     // resolution/metric/node/ + bucket start -> HistoryPoint
+	statesBucket      = []byte("states")      // kind/name -> trackedState
+	transitionsBucket = []byte("transitions") // time + sequence -> StateTransition
+	eventsBucket      = []byte("events")      // event UID -> ClusterEvent
+)
+
+// EventSource lists the Kubernetes Warning events that last occurred at or after since
+type EventSource interface {
+	WarningEvents(since time.Time) ([]metrics.ClusterEvent, error)
+}
+
+// Store persists the metric history, state transitions and Warning events in
+// an embedded bbolt database, so they survive restarts. It records every
+// collect after the in-memory history and restores that history when opened.
+type Store struct {
+	db        *bolt.DB
+	history   *history.History
+	events    EventSource
+	retention time.Duration
+
+	eventsSince time.Time // Newest Warning event saved; only touched by Record, one collect at a time
+}
+
+// trackedState is the last state seen of something whose transitions are kept
+type trackedState struct {
+	State string    `json:"state"`
+	Seen  time.Time `json:"seen"`
+}
+
+// Open opens or creates the database at path and restores hist from it.
+// Transitions and events older than retention are dropped, as are metric
+// buckets older than hist keeps them. A file that is mostly free pages after
+// deletes is rewritten first, so it does not keep the size of its busiest day.
+func Open(path string, retention time.Duration, hist *history.History, events EventSource) (*Store, error) {
+	if err := compactFile(path); err != nil {
+		log.Printf("Warning: Failed to compact %s: %v", path, err)
+	}
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: openTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	s := &Store{
+		db:        db,
+		history:   hist,
+		events:    events,
+		retention: retention,
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{metricsBucket, statesBucket, transitionsBucket, eventsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return s.expire(tx, time.Now())
+	})
+	if err == nil {
+		err = s.restore()
+	}
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Start drops expired data every hour until ctx is cancelled
+func (s *Store) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(expireInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				if err := s.db.Update(func(tx *bolt.Tx) error { return s.expire(tx, now) }); err != nil {
+					log.Printf("Error expiring history: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// Close closes the database. Records after Close are logged and dropped.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Record saves the newest metric buckets, the state transitions since the
+// last collect and new Warning events, in one transaction
+func (s *Store) Record(m *metrics.ClusterMetrics) {
+	events, err := s.events.WarningEvents(s.eventsSince)
+	if err != nil {
+		log.Printf("Error listing warning events: %v", err)
+	}
+
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		points := tx.Bucket(metricsBucket)
+		for _, series := range s.history.Newest() {
+			for _, point := range series.Points {
+				if err := putJSON(points, metricKey(series, point.Time), point); err != nil {
+					return err
+				}
+			}
+		}
+		if err := s.saveTransitions(tx, m); err != nil {
+			return err
+		}
+		stored := tx.Bucket(eventsBucket)
+		for _, event := range events {
+			if err := putJSON(stored, []byte(event.UID), event); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error saving history: %v", err)
+		return
+	}
+	if len(events) > 0 {
+		s.eventsSince = events[len(events)-1].LastSeen
+	}
+}
+
+// Transitions returns the state transitions at or after since, newest first
+func (s *Store) Transitions(since time.Time) ([]metrics.StateTransition, error) {
+	transitions := []metrics.StateTransition{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(transitionsBucket).Cursor()
+		for k, v := c.Last(); k != nil && !keyTime(k[:8]).Before(since); k, v = c.Prev() {
+			var transition metrics.StateTransition
+			if err := json.Unmarshal(v, &transition); err != nil {
+				return err
+			}
+			transitions = append(transitions, transition)
+		}
+		return nil
+	})
+	return transitions, err
+}
+
+// Events returns the Warning events last seen at or after since, newest first
+func (s *Store) Events(since time.Time) ([]metrics.ClusterEvent, error) {
+	events := []metrics.ClusterEvent{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(eventsBucket).ForEach(func(k, v []byte) error {
+			var event metrics.ClusterEvent
+			if err := json.Unmarshal(v, &event); err != nil {
+				return err
+			}
+			if !event.LastSeen.Before(since) {
+				events = append(events, event)
+			}
+			return nil
+		})
+	})
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].LastSeen.After(events[j].LastSeen)
+	})
+	return events, err
+}
+
+// restore loads the saved metric buckets into the history and finds where
+// the saved Warning events end
+func (s *Store) restore() error {
+	var restored []*metrics.HistorySeries
+	err := s.db.View(func(tx *bolt.Tx) error {
+		// Keys sort by series, then by time, so each series is read oldest first
+		var series *metrics.HistorySeries
+		err := tx.Bucket(metricsBucket).ForEach(func(k, v []byte) error {
+			resolution, metric, node, ok := parseMetricKey(k)
+			if !ok {
+				return nil
+			}
+			if series == nil || series.Resolution != resolution || series.Metric != metric || series.Node != node {
+				series = &metrics.HistorySeries{Metric: metric, Node: node, Resolution: resolution}
+				restored = append(restored, series)
+			}
+			var point metrics.HistoryPoint
+			if err := json.Unmarshal(v, &point); err != nil {
+				return err
+			}
+			series.Points = append(series.Points, point)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		return tx.Bucket(eventsBucket).ForEach(func(k, v []byte) error {
+			var event metrics.ClusterEvent
+			if err := json.Unmarshal(v, &event); err != nil {
+				return err
+			}
+			if event.LastSeen.After(s.eventsSince) {
+				s.eventsSince = event.LastSeen
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read history: %w", err)
+	}
+	return s.history.Restore(restored)
+}
+
+// expire deletes metric buckets the history no longer holds, states not seen,
+// and transitions and events not seen within the retention, then the oldest
+// transitions and events beyond their limits
+func (s *Store) expire(tx *bolt.Tx, now time.Time) error {
+	cutoff := now.Add(-s.retention)
+
+	err := deleteWhere(tx.Bucket(metricsBucket), func(k, v []byte) bool {
+		resolution, _, _, ok := parseMetricKey(k)
+		width, _ := time.ParseDuration(resolution)
+		retention := s.history.Retention(width)
+		return !ok || retention == 0 || keyTime(k[len(k)-8:]).Before(now.Add(-retention))
+	})
+	if err != nil {
+		return err
+	}
+
+	err = deleteWhere(tx.Bucket(statesBucket), func(k, v []byte) bool {
+		var state trackedState
+		return json.Unmarshal(v, &state) != nil || state.Seen.Before(cutoff)
+	})
+	if err != nil {
+		return err
+	}
+
+	// Transitions are keyed by time, so the oldest come first
+	transitions := tx.Bucket(transitionsBucket)
+	excess := transitions.Stats().KeyN - maxTransitions
+	err = deleteWhere(transitions, func(k, v []byte) bool {
+		excess--
+		return excess >= 0 || keyTime(k[:8]).Before(cutoff)
+	})
+	if err != nil {
+		return err
+	}
+
+	events := tx.Bucket(eventsBucket)
+	type seen struct {
+		uid  string
+		last time.Time
+	}
+	var kept []seen
+	err = deleteWhere(events, func(k, v []byte) bool {
+		var event metrics.ClusterEvent
+		if json.Unmarshal(v, &event) != nil || event.LastSeen.Before(cutoff) {
+			return true
+		}
+		kept = append(kept, seen{string(k), event.LastSeen})
+		return false
+	})
+	if err != nil || len(kept) <= maxEvents {
+		return err
+	}
+	sort.Slice(kept, func(i, j int) bool { return kept[i].last.Before(kept[j].last) })
+	for _, event := range kept[:len(kept)-maxEvents] {
+		if err := events.Delete([]byte(event.uid)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteWhere deletes the keys of a bucket for which drop returns true. Keys
+// are deleted after the walk, as deleting under a cursor skips the next key.
+func deleteWhere(b *bolt.Bucket, drop func(k, v []byte) bool) error {
+	var keys [][]byte
+	err := b.ForEach(func(k, v []byte) error {
+		if drop(k, v) {
+			keys = append(keys, append([]byte(nil), k...))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if err := b.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compactFile rewrites the database at path into a new file when most of it
+// is free pages. bbolt reuses freed pages but never shrinks the file itself.
+func compactFile(path string) error {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) || (err == nil && info.Size() < compactMinSize) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// Opened for writing: the free page list is not loaded read-only
+	src, err := bolt.Open(path, 0600, &bolt.Options{Timeout: openTimeout})
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	stats := src.Stats()
+	blank := float64(stats.FreePageN+stats.PendingPageN) * float64(src.Info().PageSize)
+	if blank < compactMaxBlank*float64(info.Size()) {
+		return nil
+	}
+
+	tmp := path + ".compact"
+	os.Remove(tmp)
+	dst, err := bolt.Open(tmp, 0600, &bolt.Options{Timeout: openTimeout})
+	if err != nil {
+		return err
+	}
+	if err := bolt.Compact(dst, src, 0); err != nil {
+		dst.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if compacted, err := os.Stat(tmp); err == nil {
+		log.Printf("Compacted %s from %d to %d bytes", path, info.Size(), compacted.Size())
+	}
+	return os.Rename(tmp, path)
+}
+
+// metricKey is resolution/metric/node/ followed by the bucket start, so the
+// buckets of a series sort together and by time
+func metricKey(series *metrics.HistorySeries, start time.Time) []byte {
+	prefix := series.Resolution + "/" + series.Metric + "/" + series.Node + "/"
+	return binary.BigEndian.AppendUint64([]byte(prefix), uint64(start.UnixNano()))
+}
+
+// parseMetricKey splits a metricKey into its series
+func parseMetricKey(k []byte) (resolution, metric, node string, ok bool) {
+	if len(k) < 8 {
+		return "", "", "", false
+	}
+	parts := strings.Split(string(k[:len(k)-8]), "/")
+	if len(parts) != 4 {
+		return "", "", "", false
+	}
+	return parts[0], parts[1], parts[2], true
+}
+
+// keyTime decodes a big-endian Unix nanosecond timestamp
+func keyTime(b []byte) time.Time {
+	return time.Unix(0, int64(binary.BigEndian.Uint64(b)))
+}
+
+// putJSON stores v as JSON under k
+func putJSON(b *bolt.Bucket, k []byte, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return b.Put(k, data)
+}
@@ -0,0 +1,92 @@
+package store
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"strings"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/pi-cluster/cluster-dashboard/internal/metrics"
+)
+
+// saveTransitions compares the states in m with the last ones saved and
+// records every change. Something seen for the first time, or missing from a
+// collect, is not a transition; the saved states outlive restarts, so changes
+// across a restart are still caught.
+func (s *Store) saveTransitions(tx *bolt.Tx, m *metrics.ClusterMetrics) error {
+	states := tx.Bucket(statesBucket)
+	transitions := tx.Bucket(transitionsBucket)
+
+	for key, state := range currentStates(m) {
+		var last trackedState
+		if v := states.Get([]byte(key)); v != nil {
+			if err := json.Unmarshal(v, &last); err == nil && last.State != state {
+				kind, name, _ := strings.Cut(key, "/")
+				seq, err := transitions.NextSequence()
+				if err != nil {
+					return err
+				}
+				k := binary.BigEndian.AppendUint64(nil, uint64(m.UpdatedAt.UnixNano()))
+				k = binary.BigEndian.AppendUint64(k, seq)
+				err = putJSON(transitions, k, metrics.StateTransition{
+					Time: m.UpdatedAt,
+					Kind: kind,
+					Name: name,
+					From: last.State,
+					To:   state,
+				})
+				if err != nil {
+					return err
+				}
+			}
+		}
+		if err := putJSON(states, []byte(key), trackedState{State: state, Seen: m.UpdatedAt}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// currentStates returns the tracked states in m, keyed by kind/name. Only
+// freshly collected sections count: a stale one repeats its last data and an
+// unavailable one has none.
+func currentStates(m *metrics.ClusterMetrics) map[string]string {
+	fresh := func(section string) bool {
+		return m.Sections[section].State == metrics.SectionFresh
+	}
+
+	states := make(map[string]string)
+	for section, status := range m.Sections {
+		states["section/"+section] = status.State
+	}
+	if fresh(metrics.SectionHardware) {
+		for _, node := range m.Hardware.NodeDetails {
+			states["node/"+node.Name] = node.Status
+		}
+	}
+	if fresh(metrics.SectionTalos) {
+		// By address: an unreachable node has no hostname
+		for _, node := range m.Talos.Nodes {
+			state := node.Stage
+			if !node.Reachable {
+				state = "unreachable"
+			}
+			states["talos/"+node.Node] = state
+		}
+	}
+	if fresh(metrics.SectionFlux) {
+		for _, resource := range m.Flux.Kustomizations {
+			states["kustomization/"+resource.Namespace+"/"+resource.Name] = resource.Status
+		}
+		for _, resource := range m.Flux.HelmReleases {
+			states["helmrelease/"+resource.Namespace+"/"+resource.Name] = resource.Status
+		}
+	}
+	if fresh(metrics.SectionApplications) {
+		for _, app := range m.Applications {
+			states["application/"+app.Namespace+"/"+app.Name] = app.Status
+		}
+	}
+	return states
+}
@@ -2,109 +2,393 @@ package talos
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/netip"
 	"os"
-	"os/exec"
-	"strconv"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/cosi-project/runtime/pkg/safe"
 	"github.com/pi-cluster/cluster-dashboard/internal/metrics"
+	"github.com/siderolabs/talos/pkg/machinery/client"
+	clientconfig "github.com/siderolabs/talos/pkg/machinery/client/config"
+	"github.com/siderolabs/talos/pkg/machinery/resources/runtime"
 )
 
-// Client implements the TalosClient interface
+// defaultConfigPath is where the read-only talosconfig secret is mounted
+const defaultConfigPath = "/var/run/secrets/talos.dev/config"
+
+// defaultElevatedConfigPath is where the chart mounts the elevated talosconfig,
+// only when admin actions are enabled
+const defaultElevatedConfigPath = "/var/run/secrets/talos.dev-admin/config"
+
+// nodeTimeout bounds the API calls made against a single node
+const nodeTimeout = 10 * time.Second
+
+// watchedServices are the Talos services reported on the dashboard, in display order.
+// Workers do not run etcd or trustd, so services a node does not have are skipped.
+var watchedServices = []string{"apid", "etcd", "kubelet", "containerd", "trustd"}
+
+// Service health states
+const (
+	serviceHealthy   = "Healthy"
+	serviceUnhealthy = "Unhealthy"
+	serviceUnknown   = "Unknown"
+)
+
+// Client implements the TalosClient interface using the Talos machinery gRPC client
 type Client struct {
-	// For now, we'll use a mock implementation
-	// In production, you'd use the Talos gRPC client
-	enabled bool
+	client             *client.Client
+	elevated           *client.Client // os:admin, for power actions, upgrades and drift; nil when not mounted
+	elevatedErr        error          // Why elevated is nil
+	nodes              []string
+	etcdQuota          int64
+	storageMounts      []string
+	storageWarnPercent float64
+	staticAddresses    map[string]netip.Prefix // Hostname -> provisioned address
+	expectedDir        string                  // Expected patches for drift detection
+	disks              *diskSampler
+	net                *netSampler
+	vip                *vipTracker
+	err                error // Set when the client could not be configured
 }
 
-// NewClient creates a new Talos client
+// NewClient creates a new Talos client from the talosconfig at TALOSCONFIG,
+// falling back to the mounted secret. Nodes are taken from TALOS_NODES
+// (comma-separated), then the talosconfig context's nodes, then its endpoints.
+//
+// The returned client is always usable: when err is non-nil every call
+// reports it wrapped in metrics.ErrTalosUnavailable.
 func NewClient() (*Client, error) {
-	// Check if Talos config is available
-	_, err := os.Stat("/var/run/secrets/talos.dev/config")
-	enabled := err == nil
+	configPath := os.Getenv("TALOSCONFIG")
+	if configPath == "" {
+		configPath = defaultConfigPath
+	}
+
+	// Read the file directly: clientconfig.Open creates missing files, and the mount is read-only
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		err = fmt.Errorf("failed to read talosconfig: %w", err)
+		return &Client{err: err}, err
+	}
+	cfg, err := clientconfig.FromBytes(data)
+	if err != nil {
+		err = fmt.Errorf("failed to parse talosconfig %s: %w", configPath, err)
+		return &Client{err: err}, err
+	}
+
+	nodes := configuredNodes(cfg)
+	if len(nodes) == 0 {
+		err = errors.New("no Talos nodes configured: set TALOS_NODES or nodes in the talosconfig context")
+		return &Client{err: err}, err
+	}
+
+	c, err := client.New(context.Background(), client.WithConfig(cfg))
+	if err != nil {
+		err = fmt.Errorf("failed to create talos client: %w", err)
+		return &Client{err: err}, err
+	}
+
+	storageMounts, storageWarnPercent := storageConfig()
+	elevated, elevatedErr := newElevatedClient()
+	if elevatedErr != nil && !errors.Is(elevatedErr, metrics.ErrTalosNoElevatedConfig) {
+		log.Printf("Warning: %v", elevatedErr)
+	}
 
 	return &Client{
-		enabled: enabled,
+		client:             c,
+		elevated:           elevated,
+		elevatedErr:        elevatedErr,
+		nodes:              nodes,
+		etcdQuota:          etcdQuota(),
+		storageMounts:      storageMounts,
+		storageWarnPercent: storageWarnPercent,
+		staticAddresses:    staticAddresses(),
+		expectedDir:        expectedDir(),
+		disks:              newDiskSampler(),
+		net:                newNetSampler(),
+		vip:                newVIPTracker(),
 	}, nil
 }
 
-// GetTalosStatus retrieves Talos cluster status
-func (c *Client) GetTalosStatus(ctx context.Context) (*metrics.TalosStatus, error) {
-	if !c.enabled {
-		// Return mock data if Talos API is not accessible
-		return &metrics.TalosStatus{
-			Version:       "v1.8.x",
-			ClusterHealth: "Healthy",
-			Services: map[string]string{
-				"kubelet": "Running",
-				"etcd":    "Running",
-				"apid":    "Running",
-			},
-			Healthy: true,
-		}, nil
-	}
-
-	// In production, you would use:
-	// - talos.NewClient() to create a gRPC client
-	// - client.Health() to check cluster health
-	// - client.ServiceList() to get service status
-	// - client.Version() to get version info
-	//
-	// For now, return mock data
-	return &metrics.TalosStatus{
-		Version:       "v1.8.x",
-		ClusterHealth: "Healthy",
-		Services: map[string]string{
-			"kubelet": "Running",
-			"etcd":    "Running",
-			"apid":    "Running",
-		},
-		Healthy: true,
-	}, nil
+// newElevatedClient creates a client from the elevated talosconfig at
+// TALOSCONFIG_ELEVATED, falling back to its mount point. It is kept apart from
+// the read-only one, which the read paths keep using.
+func newElevatedClient() (*client.Client, error) {
+	configPath := os.Getenv("TALOSCONFIG_ELEVATED")
+	if configPath == "" {
+		configPath = defaultElevatedConfigPath
+	}
+
+	data, err := os.ReadFile(configPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: set admin.talosSecret to a talosconfig with the os:admin role", metrics.ErrTalosNoElevatedConfig)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read elevated talosconfig: %w", err)
+	}
+	cfg, err := clientconfig.FromBytes(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse elevated talosconfig %s: %w", configPath, err)
+	}
+	c, err := client.New(context.Background(), client.WithConfig(cfg))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create elevated talos client: %w", err)
+	}
+	return c, nil
 }
 
-// GetVersion retrieves Talos version
-func (c *Client) GetVersion(ctx context.Context) (string, error) {
-	if !c.enabled {
-		return "v1.8.x", nil
+// elevatedClient returns the client for calls the os:reader role may not make
+func (c *Client) elevatedClient() (*client.Client, error) {
+	if c.err != nil {
+		return nil, fmt.Errorf("%w: %v", metrics.ErrTalosUnavailable, c.err)
+	}
+	if c.elevated == nil {
+		return nil, c.elevatedErr
+	}
+	return c.elevated, nil
+}
+
+// configuredNodes returns the nodes to query, in the order described on NewClient
+func configuredNodes(cfg *clientconfig.Config) []string {
+	if env := os.Getenv("TALOS_NODES"); env != "" {
+		var nodes []string
+		for _, node := range strings.Split(env, ",") {
+			if node = strings.TrimSpace(node); node != "" {
+				nodes = append(nodes, node)
+			}
+		}
+		return nodes
+	}
+
+	talosContext, ok := cfg.Contexts[cfg.Context]
+	if !ok {
+		return nil
+	}
+	if len(talosContext.Nodes) > 0 {
+		return talosContext.Nodes
 	}
+	return talosContext.Endpoints
+}
+
+// GetTalosStatus retrieves version, machine stage, service health and VIP ownership from every node
+func (c *Client) GetTalosStatus(ctx context.Context) (*metrics.TalosStatus, error) {
+	if c.err != nil {
+		return nil, fmt.Errorf("%w: %v", metrics.ErrTalosUnavailable, c.err)
+	}
+
+	nodes := make([]metrics.TalosNode, len(c.nodes))
+	var wg sync.WaitGroup
+	for i, node := range c.nodes {
+		wg.Add(1)
+		go func(i int, node string) {
+			defer wg.Done()
+			nodes[i] = c.nodeStatus(ctx, node)
+		}(i, node)
+	}
+	wg.Wait()
 
-	// In production, use talos client.Version()
-	return "v1.8.x", nil
+	status := summarizeNodes(nodes)
+	if c.vip.address.IsValid() {
+		status.VIP = c.vip.observe(nodes)
+		if status.VIP.Warning != "" && status.Healthy {
+			status.Healthy = false
+			status.ClusterHealth = "Degraded (VIP)"
+		}
+	}
+	return status, nil
 }
 
-// GetNodeTemperature retrieves CPU temperature for a specific node
-func (c *Client) GetNodeTemperature(ctx context.Context, nodeIP string) (float64, error) {
-	// Use talosctl to read temperature from thermal zone
-	cmd := exec.CommandContext(ctx, "talosctl", "read", "/sys/class/thermal/thermal_zone0/temp", "--nodes", nodeIP)
+// nodeStatus queries one node. Failures are recorded on the node rather than
+// returned so one unreachable node does not hide the others.
+func (c *Client) nodeStatus(ctx context.Context, node string) metrics.TalosNode {
+	ctx, cancel := context.WithTimeout(client.WithNode(ctx, node), nodeTimeout)
+	defer cancel()
 
-	output, err := cmd.CombinedOutput()
+	status := metrics.TalosNode{
+		Node:     node,
+		Stage:    "unknown",
+		Services: []metrics.TalosService{},
+	}
+
+	version, err := c.client.Version(ctx)
 	if err != nil {
-		// If we can't get temperature, return 0 instead of erroring
-		return 0, nil
+		status.Error = fmt.Sprintf("unreachable: %v", err)
+		return status
+	}
+	status.Reachable = true
+	if len(version.Messages) > 0 {
+		status.Hostname = version.Messages[0].GetMetadata().GetHostname()
+		status.Version = version.Messages[0].GetVersion().GetTag()
 	}
 
-	// Parse output - format is the raw temperature value in millidegrees
-	outputStr := strings.TrimSpace(string(output))
+	var errs []string
 
-	// Temperature is in millidegrees Celsius, convert to degrees
-	millidegrees, err := strconv.ParseFloat(outputStr, 64)
+	machine, err := safe.StateGet[*runtime.MachineStatus](ctx, c.client.COSI, runtime.NewMachineStatus().Metadata())
 	if err != nil {
-		return 0, nil
+		errs = append(errs, fmt.Sprintf("machine status: %v", err))
+	} else {
+		spec := machine.TypedSpec()
+		status.Stage = spec.Stage.String()
+		status.MachineReady = spec.Status.Ready
+		for _, cond := range spec.Status.UnmetConditions {
+			status.UnmetConditions = append(status.UnmetConditions, fmt.Sprintf("%s: %s", cond.Name, cond.Reason))
+		}
 	}
 
-	celsius := millidegrees / 1000.0
-	return celsius, nil
+	services, err := c.client.ServiceList(ctx)
+	if err != nil {
+		errs = append(errs, fmt.Sprintf("service list: %v", err))
+	} else if len(services.Messages) > 0 {
+		byID := make(map[string]metrics.TalosService)
+		for _, svc := range services.Messages[0].GetServices() {
+			byID[svc.GetId()] = serviceStatus(svc.GetId(), svc.GetState(), svc.GetHealth().GetUnknown(), svc.GetHealth().GetHealthy(), svc.GetHealth().GetLastMessage())
+		}
+		for _, id := range watchedServices {
+			if svc, ok := byID[id]; ok {
+				status.Services = append(status.Services, svc)
+			}
+		}
+	}
+
+	if c.vip.address.IsValid() {
+		holds, err := c.holdsVIP(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("addresses: %v", err))
+		}
+		status.HoldsVIP = holds
+	}
+
+	status.Error = strings.Join(errs, "; ")
+	status.Healthy = status.Error == "" && status.Stage == "running" && status.MachineReady
+	for _, svc := range status.Services {
+		if !svc.Healthy {
+			status.Healthy = false
+		}
+	}
+
+	return status
 }
 
-// Note: To enable full Talos integration, you would:
-// 1. Mount Talos config as a secret in the pod
-// 2. Import "github.com/siderolabs/talos/pkg/machinery/client"
-// 3. Create client with:
-//    config, _ := clientconfig.Open(configPath)
-//    opts := []client.OptionFunc{client.WithConfig(config)}
-//    c, _ := client.New(ctx, opts...)
-// 4. Use the client methods to query Talos API
-//
-// For security, the dashboard pod would need a read-only Talos config
-// with minimal permissions (health checks and version info only)
+// serviceStatus judges one service. Services without a health check report
+// unknown health and are judged on their state alone.
+func serviceStatus(id, state string, unknown, healthy bool, message string) metrics.TalosService {
+	svc := metrics.TalosService{
+		ID:      id,
+		State:   state,
+		Health:  serviceUnknown,
+		Message: message,
+	}
+	if !unknown {
+		svc.Health = serviceUnhealthy
+		if healthy {
+			svc.Health = serviceHealthy
+		}
+	}
+	svc.Healthy = state == "Running" && svc.Health != serviceUnhealthy
+	return svc
+}
+
+// summarizeNodes rolls per-node results up into the cluster-wide status
+func summarizeNodes(nodes []metrics.TalosNode) *metrics.TalosStatus {
+	status := &metrics.TalosStatus{
+		Version:  "Unknown",
+		Services: make(map[string]string),
+		Nodes:    nodes,
+	}
+
+	versions := make(map[string]bool)
+	reachable, healthy := 0, 0
+	for _, node := range nodes {
+		if node.Reachable {
+			reachable++
+			if node.Version != "" {
+				versions[node.Version] = true
+			}
+		}
+		if node.Healthy {
+			healthy++
+		}
+	}
+
+	if len(versions) > 0 {
+		tags := make([]string, 0, len(versions))
+		for tag := range versions {
+			tags = append(tags, tag)
+		}
+		sort.Strings(tags)
+		status.Version = tags[0]
+		if len(tags) > 1 {
+			status.Version = "Mixed: " + strings.Join(tags, ", ")
+		}
+	}
+
+	switch {
+	case reachable == 0:
+		status.ClusterHealth = "Unreachable"
+		status.Error = "no Talos node answered"
+	case healthy == len(nodes):
+		status.ClusterHealth = "Healthy"
+		status.Healthy = true
+	default:
+		status.ClusterHealth = fmt.Sprintf("Degraded (%d/%d nodes healthy)", healthy, len(nodes))
+	}
+
+	// Services map: "Running" when healthy everywhere it runs, else the failing nodes
+	for _, id := range watchedServices {
+		var failing []string
+		found := false
+		for _, node := range nodes {
+			for _, svc := range node.Services {
+				if svc.ID != id {
+					continue
+				}
+				found = true
+				if !svc.Healthy {
+					name := node.Hostname
+					if name == "" {
+						name = node.Node
+					}
+					failing = append(failing, fmt.Sprintf("%s on %s", svc.State, name))
+				}
+			}
+		}
+		switch {
+		case !found:
+			continue
+		case len(failing) == 0:
+			status.Services[id] = "Running"
+		default:
+			status.Services[id] = strings.Join(failing, ", ")
+		}
+	}
+
+	return status
+}
+
+// GetVersion retrieves the Talos version of the first node that answers
+func (c *Client) GetVersion(ctx context.Context) (string, error) {
+	if c.err != nil {
+		return "", fmt.Errorf("%w: %v", metrics.ErrTalosUnavailable, c.err)
+	}
+
+	var lastErr error
+	for _, node := range c.nodes {
+		nodeCtx, cancel := context.WithTimeout(client.WithNode(ctx, node), nodeTimeout)
+		resp, err := c.client.Version(nodeCtx)
+		cancel()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if len(resp.Messages) > 0 {
+			return resp.Messages[0].GetVersion().GetTag(), nil
+		}
+	}
+	return "", fmt.Errorf("failed to get talos version: %w", lastErr)
+}
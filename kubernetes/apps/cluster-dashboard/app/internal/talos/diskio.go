@@ -0,0 +1,209 @@
+package talos
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pi-cluster/cluster-dashboard/internal/metrics"
+	"github.com/siderolabs/talos/pkg/machinery/client"
+)
+
+const (
+	blockRoot  = "/sys/block"
+	uptimeFile = "/proc/uptime"
+	sectorSize = 512 // /sys/block/*/stat always counts 512-byte sectors
+)
+
+// defaultSDEnduranceTBW is the write budget assumed for an SD card when SD_ENDURANCE_TBW is not set.
+// Consumer cards rarely publish one; 10 TB is a conservative figure for a 32 GB card.
+const defaultSDEnduranceTBW = 10
+
+// diskSample is one reading of the counters in /sys/block/<dev>/stat
+type diskSample struct {
+	at           time.Time
+	readIOs      uint64
+	readSectors  uint64
+	writeIOs     uint64
+	writeSectors uint64
+}
+
+// diskSampler keeps the previous sample of every device so rates can be computed,
+// and the latest result per node for GetNodeDiskIO
+type diskSampler struct {
+	mu             sync.Mutex
+	enduranceBytes uint64
+	previous       map[string]map[string]diskSample // node -> device -> sample
+	latest         map[string]*metrics.NodeDiskIO
+}
+
+// newDiskSampler reads the SD endurance budget from SD_ENDURANCE_TBW
+func newDiskSampler() *diskSampler {
+	tbw := float64(defaultSDEnduranceTBW)
+	if value, err := strconv.ParseFloat(os.Getenv("SD_ENDURANCE_TBW"), 64); err == nil && value > 0 {
+		tbw = value
+	}
+	return &diskSampler{
+		enduranceBytes: uint64(tbw * 1e12),
+		previous:       make(map[string]map[string]diskSample),
+		latest:         make(map[string]*metrics.NodeDiskIO),
+	}
+}
+
+// GetNodeDiskIO returns the latest block device sample of a node
+func (c *Client) GetNodeDiskIO(ctx context.Context, nodeIP string) (*metrics.NodeDiskIO, error) {
+	if c.err != nil {
+		return nil, fmt.Errorf("%w: %v", metrics.ErrTalosUnavailable, c.err)
+	}
+
+	c.disks.mu.Lock()
+	defer c.disks.mu.Unlock()
+	latest, ok := c.disks.latest[nodeIP]
+	if !ok {
+		return nil, fmt.Errorf("no disk sample for %s yet", nodeIP)
+	}
+	result := *latest
+	result.Devices = append([]metrics.DiskIO(nil), latest.Devices...)
+	return &result, nil
+}
+
+// sampleDiskIO reads every block device of a node and stores rates against the previous sample
+func (c *Client) sampleDiskIO(ctx context.Context, node string) {
+	ctx, cancel := context.WithTimeout(client.WithNode(ctx, node), nodeTimeout)
+	defer cancel()
+
+	result := &metrics.NodeDiskIO{
+		Devices:   []metrics.DiskIO{},
+		SampledAt: time.Now(),
+	}
+	samples, uptime, wearInfo, err := c.readDiskStats(ctx)
+
+	c.disks.mu.Lock()
+	defer c.disks.mu.Unlock()
+
+	if err != nil {
+		log.Printf("Warning: failed to sample disk I/O on %s: %v", node, err)
+		result.Error = err.Error()
+		c.disks.latest[node] = result
+		return
+	}
+
+	previous := c.disks.previous[node]
+	for _, name := range deviceNames(samples) {
+		sample := samples[name]
+		device := metrics.DiskIO{
+			Name:         name,
+			BytesRead:    sample.readSectors * sectorSize,
+			BytesWritten: sample.writeSectors * sectorSize,
+		}
+		if uptime > 0 {
+			device.BytesWrittenPerDay = float64(device.BytesWritten) / (uptime / 86400)
+		}
+
+		// Counters restart at zero when the node reboots; skip rates until the next sample
+		if prev, ok := previous[name]; ok && sample.writeSectors >= prev.writeSectors && sample.readSectors >= prev.readSectors {
+			if elapsed := sample.at.Sub(prev.at).Seconds(); elapsed > 0 {
+				device.ReadBytesPerSec = float64(sample.readSectors-prev.readSectors) * sectorSize / elapsed
+				device.WriteBytesPerSec = float64(sample.writeSectors-prev.writeSectors) * sectorSize / elapsed
+				device.ReadIOPS = float64(sample.readIOs-prev.readIOs) / elapsed
+				device.WriteIOPS = float64(sample.writeIOs-prev.writeIOs) / elapsed
+			}
+		}
+
+		if strings.HasPrefix(name, "mmcblk") {
+			device.Wear = c.disks.judgeWear(device.BytesWrittenPerDay, wearInfo[name])
+		}
+		result.Devices = append(result.Devices, device)
+	}
+
+	c.disks.previous[node] = samples
+	c.disks.latest[node] = result
+}
+
+// readDiskStats reads /sys/block/*/stat, the node's uptime in seconds and,
+// for eMMC devices, the life_time estimate
+func (c *Client) readDiskStats(ctx context.Context) (map[string]diskSample, float64, map[string]string, error) {
+	names, err := c.listDir(ctx, blockRoot)
+	if err != nil {
+		return nil, 0, nil, fmt.Errorf("failed to list %s: %w", blockRoot, err)
+	}
+
+	samples := make(map[string]diskSample)
+	wearInfo := make(map[string]string)
+	for _, name := range names {
+		if ignoredDisk(name) || strings.HasSuffix(name, "boot0") || strings.HasSuffix(name, "boot1") || strings.HasSuffix(name, "rpmb") {
+			continue
+		}
+		raw, err := c.readFile(ctx, path.Join(blockRoot, name, "stat"))
+		if err != nil {
+			continue
+		}
+		fields := strings.Fields(raw)
+		if len(fields) < 7 {
+			continue
+		}
+		parse := func(i int) uint64 {
+			value, _ := strconv.ParseUint(fields[i], 10, 64)
+			return value
+		}
+		samples[name] = diskSample{
+			at:           time.Now(),
+			readIOs:      parse(0),
+			readSectors:  parse(2),
+			writeIOs:     parse(4),
+			writeSectors: parse(6),
+		}
+		if strings.HasPrefix(name, "mmcblk") {
+			if lifeTime, err := c.readFile(ctx, path.Join(blockRoot, name, "device", "life_time")); err == nil {
+				wearInfo[name] = lifeTime
+			}
+		}
+	}
+
+	var uptime float64
+	if raw, err := c.readFile(ctx, uptimeFile); err == nil {
+		if fields := strings.Fields(raw); len(fields) > 0 {
+			uptime, _ = strconv.ParseFloat(fields[0], 64)
+		}
+	}
+
+	return samples, uptime, wearInfo, nil
+}
+
+// judgeWear projects how long the endurance budget lasts at the current write rate.
+// The counters only cover the current boot, so this is a rate, not the card's history.
+func (s *diskSampler) judgeWear(bytesPerDay float64, lifeTime string) *metrics.SDWear {
+	wear := &metrics.SDWear{
+		EnduranceBytes: s.enduranceBytes,
+		LifeTime:       lifeTime,
+		Status:         metrics.WearOK,
+	}
+	if bytesPerDay <= 0 {
+		return wear
+	}
+	wear.YearsToBudget = float64(s.enduranceBytes) / bytesPerDay / 365
+	switch {
+	case wear.YearsToBudget < 1:
+		wear.Status = metrics.WearCritical
+	case wear.YearsToBudget < 3:
+		wear.Status = metrics.WearWarning
+	}
+	return wear
+}
+
+// deviceNames returns the device names of a sample set in order
+func deviceNames(samples map[string]diskSample) []string {
+	names := make([]string, 0, len(samples))
+	for name := range samples {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
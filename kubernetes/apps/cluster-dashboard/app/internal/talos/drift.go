@@ -0,0 +1,402 @@
+package talos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/cosi-project/runtime/pkg/safe"
+	"github.com/pi-cluster/cluster-dashboard/internal/metrics"
+	"github.com/siderolabs/talos/pkg/machinery/client"
+	"github.com/siderolabs/talos/pkg/machinery/resources/config"
+	"github.com/siderolabs/talos/pkg/machinery/resources/runtime"
+	"sigs.k8s.io/yaml"
+)
+
+// defaultExpectedDir is where the expected patches are mounted. It holds common.yaml
+// (patched onto every node), <hostname>.yaml and <hostname>.*.yaml (more patches
+// for the node, e.g. its talos/patches storage patch), schematic.yaml (the Image
+// Factory schematic, raspberrypi/rpi_poe.yaml) and optionally schematic-id
+// (talos/.schematic-id).
+const defaultExpectedDir = "/etc/talos-expected"
+
+// driftFields are the machine config fields compared against the expected patches.
+// Fields the patches do not set are not checked.
+var driftFields = []string{
+	"machine.install.disk",
+	"machine.install.image",
+	"machine.network.hostname",
+	"machine.network.interfaces",
+	"machine.disks",
+	"machine.kubelet.extraMounts",
+}
+
+// driftListKeys match list elements by a field instead of by position, as Talos does when patching
+var driftListKeys = map[string]string{
+	"machine.network.interfaces":  "interface",
+	"machine.disks":               "device",
+	"machine.kubelet.extraMounts": "destination",
+}
+
+// expectedDir returns TALOS_EXPECTED_DIR or the default mount point
+func expectedDir() string {
+	if dir := os.Getenv("TALOS_EXPECTED_DIR"); dir != "" {
+		return dir
+	}
+	return defaultExpectedDir
+}
+
+// GetNodeConfigDrift compares a node's running machine config and extensions with
+// the expected patches. The machine config is a sensitive resource read with the
+// elevated talosconfig; without one only the extensions and schematic, which
+// the os:reader role can read, are compared and the error says why.
+func (c *Client) GetNodeConfigDrift(ctx context.Context, nodeIP, hostname string) (*metrics.NodeConfigDrift, error) {
+	if c.err != nil {
+		return nil, fmt.Errorf("%w: %v", metrics.ErrTalosUnavailable, c.err)
+	}
+
+	drift := &metrics.NodeConfigDrift{
+		Checked: []string{},
+		Diffs:   []metrics.ConfigDiff{},
+	}
+
+	expected, err := loadExpectedPatch(c.expectedDir, hostname)
+	if errors.Is(err, fs.ErrNotExist) {
+		drift.Status = metrics.DriftNotConfigured
+		return drift, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	extensions, schematicID, err := loadSchematic(c.expectedDir)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(client.WithNode(ctx, nodeIP), nodeTimeout)
+	defer cancel()
+
+	elevated, err := c.elevatedClient()
+	switch {
+	case errors.Is(err, metrics.ErrTalosNoElevatedConfig):
+		drift.Error = fmt.Sprintf("machine config not compared: %v", err)
+	case err != nil:
+		return nil, err
+	default:
+		actual, err := readMachineConfig(ctx, elevated, nodeIP)
+		if err != nil {
+			return nil, err
+		}
+		for _, field := range driftFields {
+			want, ok := lookupField(expected, field)
+			if !ok {
+				continue
+			}
+			got, _ := lookupField(actual, field)
+			drift.Checked = append(drift.Checked, field)
+			drift.Diffs = append(drift.Diffs, diffConfig(field, want, got)...)
+		}
+	}
+
+	if len(extensions) > 0 || schematicID != "" {
+		diffs, err := c.diffExtensions(ctx, extensions, schematicID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list extensions on %s: %w", nodeIP, err)
+		}
+		if len(extensions) > 0 {
+			drift.Checked = append(drift.Checked, "extensions")
+		}
+		if schematicID != "" {
+			drift.Checked = append(drift.Checked, "schematic")
+		}
+		drift.Diffs = append(drift.Diffs, diffs...)
+	}
+
+	switch {
+	case len(drift.Diffs) > 0:
+		drift.Status = metrics.DriftDrifted
+	case len(drift.Checked) == 0:
+		drift.Status = metrics.DriftUnknown
+	default:
+		drift.Status = metrics.DriftInSync
+	}
+	return drift, nil
+}
+
+// readMachineConfig reads the v1alpha1 document of a node's running machine config
+func readMachineConfig(ctx context.Context, elevated *client.Client, nodeIP string) (map[string]interface{}, error) {
+	machineConfig, err := safe.StateGet[*config.MachineConfig](ctx, elevated.COSI, config.NewMachineConfig(nil).Metadata())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read machine config on %s (needs the os:admin role): %w", nodeIP, err)
+	}
+	raw, err := machineConfig.Provider().Bytes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode machine config of %s: %w", nodeIP, err)
+	}
+	actual, err := v1alpha1Document(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse machine config of %s: %w", nodeIP, err)
+	}
+	return actual, nil
+}
+
+// diffExtensions checks the schematic's official extensions are installed and
+// the node booted the expected schematic
+func (c *Client) diffExtensions(ctx context.Context, expected []string, schematicID string) ([]metrics.ConfigDiff, error) {
+	list, err := safe.StateListAll[*runtime.ExtensionStatus](ctx, c.client.COSI)
+	if err != nil {
+		return nil, err
+	}
+
+	installed := make(map[string]bool)
+	var runningSchematic string
+	for i := 0; i < list.Len(); i++ {
+		meta := list.Get(i).TypedSpec().Metadata
+		// Image Factory images carry a pseudo-extension named "schematic" whose version is the schematic ID
+		if meta.Name == "schematic" {
+			runningSchematic = meta.Version
+			continue
+		}
+		installed[meta.Name] = true
+	}
+
+	var diffs []metrics.ConfigDiff
+	var missing []string
+	for _, name := range expected {
+		if !installed[name] {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		present := make([]string, 0, len(installed))
+		for name := range installed {
+			present = append(present, name)
+		}
+		sort.Strings(present)
+		diffs = append(diffs, metrics.ConfigDiff{
+			Field:    "extensions",
+			Expected: strings.Join(expected, ", "),
+			Actual:   strings.Join(present, ", "),
+		})
+	}
+	if schematicID != "" && runningSchematic != schematicID {
+		diffs = append(diffs, metrics.ConfigDiff{
+			Field:    "schematic",
+			Expected: schematicID,
+			Actual:   runningSchematic,
+		})
+	}
+	return diffs, nil
+}
+
+// loadExpectedPatch merges common.yaml, <hostname>.yaml and then the node's
+// <hostname>.*.yaml patches in name order. It returns fs.ErrNotExist when none exists.
+func loadExpectedPatch(dir, hostname string) (map[string]interface{}, error) {
+	extra, err := filepath.Glob(filepath.Join(dir, hostname+".*.yaml"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list expected config: %w", err)
+	}
+	sort.Strings(extra)
+	names := []string{"common.yaml", hostname + ".yaml"}
+	for _, path := range extra {
+		names = append(names, filepath.Base(path))
+	}
+
+	merged := map[string]interface{}{}
+	found := false
+	for _, name := range names {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read expected config: %w", err)
+		}
+		var patch map[string]interface{}
+		if err := yaml.Unmarshal(data, &patch); err != nil {
+			return nil, fmt.Errorf("failed to parse expected config %s: %w", name, err)
+		}
+		mergePatch(merged, patch)
+		found = true
+	}
+	if !found {
+		return nil, fs.ErrNotExist
+	}
+	return merged, nil
+}
+
+// mergePatch merges src into dst: maps are merged key by key, anything else is replaced
+func mergePatch(dst, src map[string]interface{}) {
+	for key, value := range src {
+		srcMap, srcIsMap := value.(map[string]interface{})
+		dstMap, dstIsMap := dst[key].(map[string]interface{})
+		if srcIsMap && dstIsMap {
+			mergePatch(dstMap, srcMap)
+			continue
+		}
+		dst[key] = value
+	}
+}
+
+// loadSchematic reads the official extensions from schematic.yaml, without the
+// siderolabs/ prefix the running extensions lack, and the ID from schematic-id
+func loadSchematic(dir string) ([]string, string, error) {
+	var extensions []string
+	data, err := os.ReadFile(filepath.Join(dir, "schematic.yaml"))
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return nil, "", fmt.Errorf("failed to read schematic: %w", err)
+	default:
+		var schematic struct {
+			Customization struct {
+				SystemExtensions struct {
+					OfficialExtensions []string `json:"officialExtensions"`
+				} `json:"systemExtensions"`
+			} `json:"customization"`
+		}
+		if err := yaml.Unmarshal(data, &schematic); err != nil {
+			return nil, "", fmt.Errorf("failed to parse schematic: %w", err)
+		}
+		for _, name := range schematic.Customization.SystemExtensions.OfficialExtensions {
+			extensions = append(extensions, strings.TrimPrefix(name, "siderolabs/"))
+		}
+	}
+
+	id, err := os.ReadFile(filepath.Join(dir, "schematic-id"))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, "", fmt.Errorf("failed to read schematic ID: %w", err)
+	}
+	return extensions, strings.TrimSpace(string(id)), nil
+}
+
+// v1alpha1Document returns the v1alpha1 machine config from a multi-document config
+func v1alpha1Document(raw []byte) (map[string]interface{}, error) {
+	for _, doc := range strings.Split(string(raw), "\n---") {
+		var parsed map[string]interface{}
+		if err := yaml.Unmarshal([]byte(doc), &parsed); err != nil {
+			return nil, err
+		}
+		if _, ok := parsed["machine"]; ok {
+			return parsed, nil
+		}
+	}
+	return nil, errors.New("no v1alpha1 document")
+}
+
+// lookupField follows a dotted path through nested maps
+func lookupField(doc map[string]interface{}, field string) (interface{}, bool) {
+	var value interface{} = doc
+	for _, key := range strings.Split(field, ".") {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = m[key]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// diffConfig compares the fields set in expected with actual, recursing into maps
+// and keyed lists so each difference is reported at the deepest useful path
+func diffConfig(path string, expected, actual interface{}) []metrics.ConfigDiff {
+	if actual == nil {
+		return []metrics.ConfigDiff{{Field: path, Expected: configValue(expected)}}
+	}
+
+	switch want := expected.(type) {
+	case map[string]interface{}:
+		got, ok := actual.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(want))
+		for key := range want {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		var diffs []metrics.ConfigDiff
+		for _, key := range keys {
+			diffs = append(diffs, diffConfig(path+"."+key, want[key], got[key])...)
+		}
+		return diffs
+
+	case []interface{}:
+		got, ok := actual.([]interface{})
+		key, keyed := driftListKeys[path]
+		if !ok || !keyed {
+			break
+		}
+		byKey := make(map[string]interface{}, len(got))
+		for _, item := range got {
+			if m, ok := item.(map[string]interface{}); ok {
+				byKey[fmt.Sprint(m[key])] = item
+			}
+		}
+		var diffs []metrics.ConfigDiff
+		for _, item := range want {
+			m, _ := item.(map[string]interface{})
+			id := fmt.Sprint(m[key])
+			diffs = append(diffs, diffConfig(fmt.Sprintf("%s[%s]", path, id), item, byKey[id])...)
+		}
+		return diffs
+	}
+
+	if projected := project(expected, actual); !reflect.DeepEqual(expected, projected) {
+		return []metrics.ConfigDiff{{Field: path, Expected: configValue(expected), Actual: configValue(actual)}}
+	}
+	return nil
+}
+
+// project drops the map keys from actual that expected does not set, so Talos'
+// defaults do not count as drift inside lists compared as a whole
+func project(expected, actual interface{}) interface{} {
+	switch want := expected.(type) {
+	case map[string]interface{}:
+		got, ok := actual.(map[string]interface{})
+		if !ok {
+			return actual
+		}
+		projected := make(map[string]interface{}, len(want))
+		for key := range want {
+			if value, ok := got[key]; ok {
+				projected[key] = project(want[key], value)
+			}
+		}
+		return projected
+	case []interface{}:
+		got, ok := actual.([]interface{})
+		if !ok || len(got) != len(want) {
+			return actual
+		}
+		projected := make([]interface{}, len(got))
+		for i := range got {
+			projected[i] = project(want[i], got[i])
+		}
+		return projected
+	}
+	return actual
+}
+
+// configValue renders a config value for display: scalars as is, the rest as YAML
+func configValue(value interface{}) string {
+	switch value.(type) {
+	case map[string]interface{}, []interface{}:
+		out, err := yaml.Marshal(value)
+		if err != nil {
+			return fmt.Sprint(value)
+		}
+		return strings.TrimSpace(string(out))
+	case nil:
+		return ""
+	}
+	return fmt.Sprint(value)
+}
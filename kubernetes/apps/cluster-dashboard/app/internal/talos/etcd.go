@@ -0,0 +1,235 @@
+package talos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/pi-cluster/cluster-dashboard/internal/metrics"
+	machineapi "github.com/siderolabs/talos/pkg/machinery/api/machine"
+	"github.com/siderolabs/talos/pkg/machinery/client"
+)
+
+// defaultEtcdQuota is etcd's default backend quota (--quota-backend-bytes), which Talos does not change
+const defaultEtcdQuota = 2 * 1024 * 1024 * 1024
+
+// etcdQuotaWarnPercent is the DB size, as a percentage of the quota, at which a warning is raised
+const etcdQuotaWarnPercent = 80
+
+// etcdLagEntries is how far a member's raft index may trail the newest one before it counts as behind
+const etcdLagEntries = 1000
+
+// etcdQuota returns the backend quota from ETCD_QUOTA_BYTES, for clusters that set
+// extraArgs quota-backend-bytes, or etcd's default
+func etcdQuota() int64 {
+	if quota, err := strconv.ParseInt(os.Getenv("ETCD_QUOTA_BYTES"), 10, 64); err == nil && quota > 0 {
+		return quota
+	}
+	return defaultEtcdQuota
+}
+
+// GetEtcdStatus retrieves the etcd member list, each member's status and active alarms
+func (c *Client) GetEtcdStatus(ctx context.Context) (*metrics.EtcdStatus, error) {
+	if c.err != nil {
+		return nil, fmt.Errorf("%w: %v", metrics.ErrTalosUnavailable, c.err)
+	}
+
+	members, node, err := c.etcdMembers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &metrics.EtcdStatus{
+		Members:    make([]metrics.EtcdMember, len(members)),
+		QuotaBytes: c.etcdQuota,
+		Alarms:     []metrics.EtcdAlarm{},
+		Warnings:   []string{},
+	}
+
+	// Query every member's own status through the node it serves clients on
+	var wg sync.WaitGroup
+	for i, member := range members {
+		wg.Add(1)
+		go func(i int, member *machineapi.EtcdMember) {
+			defer wg.Done()
+			status.Members[i] = c.etcdMemberStatus(ctx, member, status.QuotaBytes)
+		}(i, member)
+	}
+	wg.Wait()
+
+	hostnames := make(map[string]string, len(status.Members))
+	for _, member := range status.Members {
+		hostnames[member.ID] = member.Hostname
+	}
+
+	alarmCtx, cancel := context.WithTimeout(client.WithNode(ctx, node), nodeTimeout)
+	defer cancel()
+	alarms, err := c.client.EtcdAlarmList(alarmCtx)
+	if err != nil {
+		status.Warnings = append(status.Warnings, fmt.Sprintf("failed to list alarms: %v", err))
+	} else {
+		for _, msg := range alarms.GetMessages() {
+			for _, alarm := range msg.GetMemberAlarms() {
+				if alarm.GetAlarm() == machineapi.EtcdMemberAlarm_NONE {
+					continue
+				}
+				id := fmt.Sprintf("%x", alarm.GetMemberId())
+				status.Alarms = append(status.Alarms, metrics.EtcdAlarm{
+					MemberID: id,
+					Member:   hostnames[id],
+					Alarm:    alarm.GetAlarm().String(),
+				})
+			}
+		}
+	}
+
+	judgeEtcd(status)
+	return status, nil
+}
+
+// etcdMembers lists the members from the first node that answers and returns that node
+func (c *Client) etcdMembers(ctx context.Context) ([]*machineapi.EtcdMember, string, error) {
+	var lastErr error
+	for _, node := range c.nodes {
+		nodeCtx, cancel := context.WithTimeout(client.WithNode(ctx, node), nodeTimeout)
+		resp, err := c.client.EtcdMemberList(nodeCtx, &machineapi.EtcdMemberListRequest{})
+		cancel()
+		if err != nil {
+			// Workers do not run etcd; try the next node
+			lastErr = err
+			continue
+		}
+		if len(resp.GetMessages()) > 0 {
+			members := resp.GetMessages()[0].GetMembers()
+			sort.Slice(members, func(i, j int) bool { return members[i].GetHostname() < members[j].GetHostname() })
+			return members, node, nil
+		}
+	}
+	if lastErr == nil {
+		lastErr = errors.New("no node returned a member list")
+	}
+	return nil, "", fmt.Errorf("failed to list etcd members: %w", lastErr)
+}
+
+// etcdMemberStatus reads one member's status from the node behind its client URL
+func (c *Client) etcdMemberStatus(ctx context.Context, member *machineapi.EtcdMember, quota int64) metrics.EtcdMember {
+	result := metrics.EtcdMember{
+		ID:         fmt.Sprintf("%x", member.GetId()),
+		Hostname:   member.GetHostname(),
+		PeerURLs:   member.GetPeerUrls(),
+		ClientURLs: member.GetClientUrls(),
+		IsLearner:  member.GetIsLearner(),
+	}
+
+	result.Node = memberNode(member)
+	if result.Node == "" {
+		result.Error = "member has no usable client URL"
+		return result
+	}
+
+	ctx, cancel := context.WithTimeout(client.WithNode(ctx, result.Node), nodeTimeout)
+	defer cancel()
+	resp, err := c.client.EtcdStatus(ctx)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if len(resp.GetMessages()) == 0 {
+		result.Error = "empty status response"
+		return result
+	}
+
+	memberStatus := resp.GetMessages()[0].GetMemberStatus()
+	result.ProtocolVersion = memberStatus.GetProtocolVersion()
+	result.RaftTerm = memberStatus.GetRaftTerm()
+	result.RaftIndex = memberStatus.GetRaftIndex()
+	result.RaftAppliedIndex = memberStatus.GetRaftAppliedIndex()
+	result.DBSize = memberStatus.GetDbSize()
+	result.DBSizeInUse = memberStatus.GetDbSizeInUse()
+	result.IsLeader = memberStatus.GetLeader() != 0 && memberStatus.GetLeader() == memberStatus.GetMemberId()
+	result.Errors = memberStatus.GetErrors()
+	if quota > 0 {
+		result.QuotaPercent = float64(result.DBSize) / float64(quota) * 100
+	}
+	return result
+}
+
+// memberNode extracts the host of a member's first client URL
+func memberNode(member *machineapi.EtcdMember) string {
+	for _, raw := range member.GetClientUrls() {
+		u, err := url.Parse(raw)
+		if err != nil {
+			continue
+		}
+		host := u.Hostname()
+		if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+			continue
+		}
+		if host != "" {
+			return host
+		}
+	}
+	return ""
+}
+
+// judgeEtcd sets the leader, lagging members, warnings and overall health
+func judgeEtcd(status *metrics.EtcdStatus) {
+	var newestIndex uint64
+	leaders := 0
+	for _, member := range status.Members {
+		if member.RaftIndex > newestIndex {
+			newestIndex = member.RaftIndex
+		}
+		if member.RaftTerm > status.RaftTerm {
+			status.RaftTerm = member.RaftTerm
+		}
+		if member.IsLeader {
+			leaders++
+			status.Leader = member.Hostname
+		}
+	}
+
+	status.Healthy = len(status.Members) > 0
+	for i := range status.Members {
+		member := &status.Members[i]
+		switch {
+		case member.Error != "":
+			status.Warnings = append(status.Warnings, fmt.Sprintf("%s: status unavailable: %s", member.Hostname, member.Error))
+			status.Healthy = false
+			continue
+		case len(member.Errors) > 0:
+			status.Warnings = append(status.Warnings, fmt.Sprintf("%s reports errors: %v", member.Hostname, member.Errors))
+			status.Healthy = false
+		}
+
+		if newestIndex-member.RaftIndex > etcdLagEntries || member.RaftIndex > member.RaftAppliedIndex+etcdLagEntries {
+			member.Lagging = true
+			status.Warnings = append(status.Warnings, fmt.Sprintf("%s is behind: raft index %d, applied %d, newest %d",
+				member.Hostname, member.RaftIndex, member.RaftAppliedIndex, newestIndex))
+			status.Healthy = false
+		}
+		if member.QuotaPercent >= etcdQuotaWarnPercent {
+			status.Warnings = append(status.Warnings, fmt.Sprintf("%s DB is at %.0f%% of the quota; compact and defragment before it raises NOSPACE",
+				member.Hostname, member.QuotaPercent))
+			status.Healthy = false
+		}
+		if member.IsLearner {
+			status.Warnings = append(status.Warnings, fmt.Sprintf("%s is a learner and does not vote yet", member.Hostname))
+		}
+	}
+
+	if leaders == 0 {
+		status.Warnings = append(status.Warnings, "no member reports itself as leader")
+		status.Healthy = false
+	}
+	for _, alarm := range status.Alarms {
+		status.Warnings = append(status.Warnings, fmt.Sprintf("%s alarm raised by %s", alarm.Alarm, alarm.Member))
+		status.Healthy = false
+	}
+}
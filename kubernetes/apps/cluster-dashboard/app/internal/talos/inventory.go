@@ -0,0 +1,133 @@
+package talos
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cosi-project/runtime/pkg/safe"
+	"github.com/pi-cluster/cluster-dashboard/internal/metrics"
+	"github.com/siderolabs/talos/pkg/machinery/client"
+	"github.com/siderolabs/talos/pkg/machinery/resources/runtime"
+)
+
+// apidPort is the Talos API port
+const apidPort = "50000"
+
+// dialTimeout bounds the TCP check that stands in for diagnose-boot.sh's ping
+const dialTimeout = 3 * time.Second
+
+// GetTalosInventory probes every configured endpoint directly: TALOS_NODES plus the
+// static addresses. Each is checked for an open API port, then asked for its stage
+// with the talosconfig and, failing that, insecurely as a node in maintenance mode is.
+func (c *Client) GetTalosInventory(ctx context.Context) (*metrics.TalosInventory, error) {
+	if c.err != nil {
+		return nil, fmt.Errorf("%w: %v", metrics.ErrTalosUnavailable, c.err)
+	}
+
+	expected := make(map[string]string)
+	for hostname, prefix := range c.staticAddresses {
+		expected[prefix.Addr().String()] = hostname
+	}
+	addresses := append([]string{}, c.nodes...)
+	for address := range expected {
+		if !slices.Contains(addresses, address) {
+			addresses = append(addresses, address)
+		}
+	}
+	sort.Strings(addresses)
+
+	inventory := &metrics.TalosInventory{
+		Endpoints:      make([]metrics.TalosEndpoint, len(addresses)),
+		KubernetesOnly: []string{},
+		Warnings:       []string{},
+	}
+	var wg sync.WaitGroup
+	for i, address := range addresses {
+		wg.Add(1)
+		go func(i int, address string) {
+			defer wg.Done()
+			inventory.Endpoints[i] = c.probeEndpoint(ctx, address, expected[address])
+		}(i, address)
+	}
+	wg.Wait()
+
+	return inventory, nil
+}
+
+// probeEndpoint runs the checks of diagnose-boot.sh against one address
+func (c *Client) probeEndpoint(ctx context.Context, address, expectedHostname string) metrics.TalosEndpoint {
+	endpoint := metrics.TalosEndpoint{
+		Address:          address,
+		ExpectedHostname: expectedHostname,
+		Mode:             metrics.TalosModeDown,
+		Stage:            "unknown",
+	}
+
+	dialer := net.Dialer{Timeout: dialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(address, apidPort))
+	if err != nil {
+		endpoint.Error = fmt.Sprintf("Talos API port closed: %v", err)
+		return endpoint
+	}
+	conn.Close()
+	endpoint.PortOpen = true
+
+	nodeCtx, cancel := context.WithTimeout(client.WithNode(ctx, address), nodeTimeout)
+	defer cancel()
+	version, secureErr := c.client.Version(nodeCtx)
+	if secureErr == nil {
+		endpoint.Mode = metrics.TalosModeSecure
+		if len(version.Messages) > 0 {
+			endpoint.Hostname = version.Messages[0].GetMetadata().GetHostname()
+		}
+		if stage, err := machineStage(nodeCtx, c.client); err == nil {
+			endpoint.Stage = stage
+		} else {
+			endpoint.Error = fmt.Sprintf("machine status: %v", err)
+		}
+		return endpoint
+	}
+
+	stage, err := c.insecureStage(ctx, address)
+	if err != nil {
+		endpoint.Error = fmt.Sprintf("Talos API not responding: %v", secureErr)
+		return endpoint
+	}
+	endpoint.Mode = metrics.TalosModeMaintenance
+	endpoint.Stage = stage
+	return endpoint
+}
+
+// insecureStage connects to the address without client certificates, the way
+// talosctl --insecure reaches a node in maintenance mode
+func (c *Client) insecureStage(ctx context.Context, address string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, nodeTimeout)
+	defer cancel()
+
+	insecure, err := client.New(ctx,
+		client.WithEndpoints(address),
+		// A node in maintenance mode has no cluster PKI yet, so there is nothing to verify against
+		client.WithTLSConfig(&tls.Config{InsecureSkipVerify: true}),
+	)
+	if err != nil {
+		return "", err
+	}
+	defer insecure.Close()
+
+	return machineStage(ctx, insecure)
+}
+
+// machineStage reads the MachineStatus stage, e.g. "running" or "maintenance"
+func machineStage(ctx context.Context, c *client.Client) (string, error) {
+	machine, err := safe.StateGet[*runtime.MachineStatus](ctx, c.COSI, runtime.NewMachineStatus().Metadata())
+	if err != nil {
+		return "", err
+	}
+	return machine.TypedSpec().Stage.String(), nil
+}
@@ -0,0 +1,42 @@
+package talos
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/siderolabs/talos/pkg/machinery/client"
+)
+
+// RebootNode reboots a node, like `talosctl reboot`. It returns once the node
+// has accepted the request. Uses the elevated talosconfig.
+func (c *Client) RebootNode(ctx context.Context, nodeIP string) error {
+	elevated, err := c.elevatedClient()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(client.WithNode(ctx, nodeIP), nodeTimeout)
+	defer cancel()
+
+	if err := elevated.Reboot(ctx); err != nil {
+		return fmt.Errorf("failed to reboot %s (needs the os:operator role): %w", nodeIP, err)
+	}
+	return nil
+}
+
+// ShutdownNode powers a node off, like `talosctl shutdown`. A Pi stays off
+// until its power (or PoE port) is cycled. Uses the elevated talosconfig.
+func (c *Client) ShutdownNode(ctx context.Context, nodeIP string) error {
+	elevated, err := c.elevatedClient()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(client.WithNode(ctx, nodeIP), nodeTimeout)
+	defer cancel()
+
+	if err := elevated.Shutdown(ctx); err != nil {
+		return fmt.Errorf("failed to shut down %s (needs the os:operator role): %w", nodeIP, err)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package talos
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/pi-cluster/cluster-dashboard/internal/metrics"
+	"github.com/siderolabs/talos/pkg/machinery/api/common"
+	"github.com/siderolabs/talos/pkg/machinery/client"
+	"github.com/siderolabs/talos/pkg/machinery/constants"
+)
+
+// maxLogLine bounds a single log line; a longer one ends the stream with an error
+const maxLogLine = 1 << 20
+
+// StreamLogs sends a node's service log or kernel ring buffer to emit line by
+// line, like `talosctl logs <service>` or `talosctl dmesg`. tail limits the
+// lines sent before following, 0 sends them all; with follow the stream runs
+// until ctx is done. node must be one of the configured Talos nodes.
+func (c *Client) StreamLogs(ctx context.Context, node, source string, follow bool, tail int, emit func(line string)) error {
+	if c.err != nil {
+		return fmt.Errorf("%w: %v", metrics.ErrTalosUnavailable, c.err)
+	}
+	if !slices.Contains(c.nodes, node) {
+		return fmt.Errorf("talos node %s: %w", node, metrics.ErrNotFound)
+	}
+	if !slices.Contains(metrics.LogSources, source) {
+		return fmt.Errorf("log source %s: %w", source, metrics.ErrNotFound)
+	}
+
+	ctx = client.WithNode(ctx, node)
+	if source == metrics.KernelLog {
+		return c.streamKernelLog(ctx, node, follow, tail, emit)
+	}
+
+	tailLines := int32(-1) // Everything
+	if tail > 0 {
+		tailLines = int32(tail)
+	}
+	stream, err := c.client.Logs(ctx, constants.SystemContainerdNamespace, common.ContainerDriver_CONTAINERD, source, follow, tailLines)
+	if err != nil {
+		return fmt.Errorf("failed to read %s logs on %s: %w", source, node, err)
+	}
+	if err := readLines(stream, emit); err != nil {
+		return fmt.Errorf("failed to read %s logs on %s: %w", source, node, err)
+	}
+	return nil
+}
+
+// streamKernelLog streams dmesg. The Dmesg API cannot tail by line count, so
+// the whole buffer is read and its last lines sent, then only new messages are
+// followed. Messages logged between the two calls can be missed.
+func (c *Client) streamKernelLog(ctx context.Context, node string, follow bool, tail int, emit func(line string)) error {
+	stream, err := c.client.Dmesg(ctx, false, false)
+	if err != nil {
+		return fmt.Errorf("failed to read dmesg on %s: %w", node, err)
+	}
+	var lines []string
+	err = readLines(stream, func(line string) {
+		lines = append(lines, line)
+		if tail > 0 && len(lines) > 2*tail {
+			lines = append(lines[:0], lines[len(lines)-tail:]...)
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read dmesg on %s: %w", node, err)
+	}
+	if tail > 0 && len(lines) > tail {
+		lines = lines[len(lines)-tail:]
+	}
+	for _, line := range lines {
+		emit(line)
+	}
+	if !follow {
+		return nil
+	}
+
+	// tail=true skips the messages already in the buffer
+	stream, err = c.client.Dmesg(ctx, true, true)
+	if err != nil {
+		return fmt.Errorf("failed to follow dmesg on %s: %w", node, err)
+	}
+	if err := readLines(stream, emit); err != nil {
+		return fmt.Errorf("failed to follow dmesg on %s: %w", node, err)
+	}
+	return nil
+}
+
+// readLines splits a Talos data stream into lines. It returns nil when the
+// stream ends or its context is cancelled.
+func readLines(stream client.MachineStream, emit func(line string)) error {
+	r, err := client.ReadStream(stream)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLogLine)
+	for scanner.Scan() {
+		emit(scanner.Text())
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,292 @@
+package talos
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/netip"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cosi-project/runtime/pkg/safe"
+	"github.com/pi-cluster/cluster-dashboard/internal/metrics"
+	"github.com/siderolabs/talos/pkg/machinery/client"
+	"github.com/siderolabs/talos/pkg/machinery/nethelpers"
+	"github.com/siderolabs/talos/pkg/machinery/resources/network"
+)
+
+// netDevFile holds the per-interface counters
+const netDevFile = "/proc/net/dev"
+
+// minLinkSpeedMbps is the speed every Pi should negotiate; anything lower is a cable or switch port problem
+const minLinkSpeedMbps = 1000
+
+// defaultStaticAddresses are the addresses talos/apply-static-ip-configs.sh provisions, by hostname
+var defaultStaticAddresses = map[string]string{
+	"talos-cp1":     "192.168.1.11/24",
+	"talos-cp2":     "192.168.1.12/24",
+	"talos-cp3":     "192.168.1.13/24",
+	"talos-worker1": "192.168.1.14/24",
+}
+
+// staticAddresses reads STATIC_ADDRESSES (comma-separated hostname=address/prefix),
+// falling back to the provisioned addresses
+func staticAddresses() map[string]netip.Prefix {
+	entries := make(map[string]string, len(defaultStaticAddresses))
+	if env := os.Getenv("STATIC_ADDRESSES"); env != "" {
+		for _, entry := range strings.Split(env, ",") {
+			if hostname, address, ok := strings.Cut(strings.TrimSpace(entry), "="); ok {
+				entries[strings.TrimSpace(hostname)] = strings.TrimSpace(address)
+			}
+		}
+	} else {
+		for hostname, address := range defaultStaticAddresses {
+			entries[hostname] = address
+		}
+	}
+
+	addresses := make(map[string]netip.Prefix, len(entries))
+	for hostname, address := range entries {
+		prefix, err := netip.ParsePrefix(address)
+		if err != nil {
+			log.Printf("Warning: ignoring static address %q for %s: %v", address, hostname, err)
+			continue
+		}
+		addresses[hostname] = prefix
+	}
+	return addresses
+}
+
+// netCounters is one reading of an interface's line in /proc/net/dev
+type netCounters struct {
+	at        time.Time
+	rxBytes   uint64
+	rxErrors  uint64
+	rxDropped uint64
+	txBytes   uint64
+	txErrors  uint64
+	txDropped uint64
+}
+
+// netSample is the latest counters and rates of a node's interfaces, or why they could not be read
+type netSample struct {
+	at         time.Time
+	err        error
+	interfaces map[string]metrics.NetInterface
+}
+
+// netSampler keeps the previous counters of every interface so rates can be
+// computed, and the latest sample per node for GetNodeNetwork
+type netSampler struct {
+	mu       sync.Mutex
+	previous map[string]map[string]netCounters // node -> interface -> counters
+	latest   map[string]netSample
+}
+
+// newNetSampler creates an empty sampler
+func newNetSampler() *netSampler {
+	return &netSampler{
+		previous: make(map[string]map[string]netCounters),
+		latest:   make(map[string]netSample),
+	}
+}
+
+// sampleNetDev reads /proc/net/dev on a node and stores rates against the previous sample
+func (c *Client) sampleNetDev(ctx context.Context, node string) {
+	ctx, cancel := context.WithTimeout(client.WithNode(ctx, node), nodeTimeout)
+	defer cancel()
+
+	at := time.Now()
+	raw, err := c.readFile(ctx, netDevFile)
+
+	c.net.mu.Lock()
+	defer c.net.mu.Unlock()
+
+	if err != nil {
+		log.Printf("Warning: failed to sample %s on %s: %v", netDevFile, node, err)
+		c.net.latest[node] = netSample{at: at, err: err}
+		return
+	}
+	counters := parseNetDev(raw, at)
+
+	previous := c.net.previous[node]
+	latest := make(map[string]metrics.NetInterface, len(counters))
+	for name, current := range counters {
+		iface := metrics.NetInterface{
+			Sampled:   true,
+			RxBytes:   current.rxBytes,
+			TxBytes:   current.txBytes,
+			RxErrors:  current.rxErrors,
+			TxErrors:  current.txErrors,
+			RxDropped: current.rxDropped,
+			TxDropped: current.txDropped,
+		}
+		// Counters restart at zero when the node reboots; skip rates until the next sample
+		if prev, ok := previous[name]; ok && current.rxBytes >= prev.rxBytes && current.txBytes >= prev.txBytes {
+			if elapsed := current.at.Sub(prev.at).Seconds(); elapsed > 0 {
+				iface.Rated = true
+				iface.RxBytesPerSec = float64(current.rxBytes-prev.rxBytes) / elapsed
+				iface.TxBytesPerSec = float64(current.txBytes-prev.txBytes) / elapsed
+			}
+			before := prev.rxErrors + prev.txErrors + prev.rxDropped + prev.txDropped
+			if after := current.rxErrors + current.txErrors + current.rxDropped + current.txDropped; after > before {
+				iface.NewErrors = after - before
+			}
+		}
+		latest[name] = iface
+	}
+
+	c.net.previous[node] = counters
+	c.net.latest[node] = netSample{at: at, interfaces: latest}
+}
+
+// parseNetDev parses /proc/net/dev: two header lines, then "name: rx fields... tx fields..."
+func parseNetDev(raw string, at time.Time) map[string]netCounters {
+	counters := make(map[string]netCounters)
+	for _, line := range strings.Split(raw, "\n") {
+		name, rest, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(rest)
+		if len(fields) < 12 {
+			continue
+		}
+		parse := func(i int) uint64 {
+			value, _ := strconv.ParseUint(fields[i], 10, 64)
+			return value
+		}
+		counters[strings.TrimSpace(name)] = netCounters{
+			at:        at,
+			rxBytes:   parse(0),
+			rxErrors:  parse(2),
+			rxDropped: parse(3),
+			txBytes:   parse(8),
+			txErrors:  parse(10),
+			txDropped: parse(11),
+		}
+	}
+	return counters
+}
+
+// GetNodeNetwork reads the link state and addresses of a node's physical interfaces,
+// adds the sampled counters and checks them against the node's static address
+func (c *Client) GetNodeNetwork(ctx context.Context, nodeIP, hostname string) (*metrics.NodeNetwork, error) {
+	if c.err != nil {
+		return nil, fmt.Errorf("%w: %v", metrics.ErrTalosUnavailable, c.err)
+	}
+
+	ctx, cancel := context.WithTimeout(client.WithNode(ctx, nodeIP), nodeTimeout)
+	defer cancel()
+
+	links, err := safe.StateListAll[*network.LinkStatus](ctx, c.client.COSI)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list links on %s: %w", nodeIP, err)
+	}
+	addresses, err := safe.StateListAll[*network.AddressStatus](ctx, c.client.COSI)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list addresses on %s: %w", nodeIP, err)
+	}
+
+	byLink := make(map[string][]string)
+	for i := 0; i < addresses.Len(); i++ {
+		spec := addresses.Get(i).TypedSpec()
+		byLink[spec.LinkName] = append(byLink[spec.LinkName], spec.Address.String())
+	}
+
+	c.net.mu.Lock()
+	sample, sampled := c.net.latest[nodeIP]
+	c.net.mu.Unlock()
+
+	result := &metrics.NodeNetwork{
+		Interfaces: []metrics.NetInterface{},
+		Warnings:   []string{},
+		SampledAt:  sample.at,
+	}
+	// Without a sample the counters are unknown, which must not read as an idle link
+	switch {
+	case !sampled:
+		result.SampleError = "not sampled yet"
+	case sample.err != nil:
+		result.SampleError = fmt.Sprintf("failed to read %s: %v", netDevFile, sample.err)
+	}
+	counters := sample.interfaces
+	for i := 0; i < links.Len(); i++ {
+		link := links.Get(i)
+		spec := link.TypedSpec()
+		if !spec.Physical() {
+			continue
+		}
+		iface := counters[link.Metadata().ID()]
+		iface.Name = link.Metadata().ID()
+		iface.MAC = spec.HardwareAddr.String()
+		iface.Up = spec.LinkState
+		iface.OperState = spec.OperationalState.String()
+		iface.SpeedMbps = spec.SpeedMegabits
+		iface.Duplex = spec.Duplex.String()
+		iface.MTU = spec.MTU
+		iface.Addresses = byLink[iface.Name]
+		if iface.Addresses == nil {
+			iface.Addresses = []string{}
+		}
+		sort.Strings(iface.Addresses)
+		result.Interfaces = append(result.Interfaces, iface)
+	}
+	sort.Slice(result.Interfaces, func(i, j int) bool { return result.Interfaces[i].Name < result.Interfaces[j].Name })
+
+	c.judgeNetwork(result, nodeIP, hostname)
+	return result, nil
+}
+
+// judgeNetwork warns about links that are down, slow or losing packets, and
+// about a static address that is missing from the node
+func (c *Client) judgeNetwork(result *metrics.NodeNetwork, nodeIP, hostname string) {
+	if len(result.Interfaces) == 0 {
+		result.Warnings = append(result.Warnings, "no physical interfaces found")
+	}
+
+	for _, iface := range result.Interfaces {
+		// Unused ports (e.g. WiFi without config) are down with no address; only judge the ones in use
+		if len(iface.Addresses) == 0 && !iface.Up {
+			continue
+		}
+		if !iface.Up {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("%s has no carrier (%s)", iface.Name, iface.OperState))
+			continue
+		}
+		if iface.SpeedMbps > 0 && iface.SpeedMbps < minLinkSpeedMbps {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("%s negotiated %d Mbit/s instead of %d: check the cable and switch port",
+				iface.Name, iface.SpeedMbps, minLinkSpeedMbps))
+		}
+		if iface.Duplex == nethelpers.Half.String() {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("%s is running half duplex", iface.Name))
+		}
+		if iface.NewErrors > 0 {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("%s: %d errors or drops in the last interval", iface.Name, iface.NewErrors))
+		}
+	}
+
+	expected, ok := c.staticAddresses[hostname]
+	if !ok {
+		return
+	}
+	result.ExpectedAddress = expected.String()
+	found := false
+	for _, iface := range result.Interfaces {
+		for _, address := range iface.Addresses {
+			if address == expected.String() {
+				found = true
+			}
+		}
+	}
+	if !found {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("static address %s is not assigned", expected))
+	}
+	if expected.Addr().String() != nodeIP {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("node answers on %s instead of its static address %s", nodeIP, expected.Addr()))
+	}
+}
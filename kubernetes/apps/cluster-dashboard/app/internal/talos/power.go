@@ -0,0 +1,137 @@
+package talos
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/pi-cluster/cluster-dashboard/internal/metrics"
+	"github.com/siderolabs/talos/pkg/machinery/client"
+)
+
+// Files read for power health. get_throttled is only exposed by the Raspberry Pi
+// firmware driver; on kernels without it under-voltage comes from the rpi_volt hwmon.
+const (
+	cpufreqDir     = "/sys/devices/system/cpu/cpu0/cpufreq"
+	getThrottled   = "/sys/devices/platform/soc/soc:firmware/get_throttled"
+	hwmonRoot      = "/sys/class/hwmon"
+	rpiVoltHwmon   = "rpi_volt"
+	cpuThermalZone = "/sys/class/thermal/thermal_zone0"
+	maxTripPoints  = 16
+)
+
+// get_throttled bits, see the Raspberry Pi vcgencmd documentation
+const (
+	throttleUnderVoltage          = 1 << 0
+	throttleFreqCapped            = 1 << 1
+	throttleThrottled             = 1 << 2
+	throttleSoftTempLimit         = 1 << 3
+	throttleUnderVoltageOccurred  = 1 << 16
+	throttleFreqCappedOccurred    = 1 << 17
+	throttleThrottledOccurred     = 1 << 18
+	throttleSoftTempLimitOccurred = 1 << 19
+)
+
+// GetNodePower reads CPU frequency, firmware throttle flags, under-voltage and the
+// CPU thermal zone's trip points. Files that are not readable are skipped; an error
+// means nothing could be read at all.
+func (c *Client) GetNodePower(ctx context.Context, nodeIP string) (*metrics.NodePower, error) {
+	if c.err != nil {
+		return nil, fmt.Errorf("%w: %v", metrics.ErrTalosUnavailable, c.err)
+	}
+
+	ctx, cancel := context.WithTimeout(client.WithNode(ctx, nodeIP), nodeTimeout)
+	defer cancel()
+
+	power := &metrics.NodePower{
+		TripPoints: []metrics.TripPoint{},
+		Warnings:   []string{},
+	}
+
+	var firstErr error
+	readKHz := func(name string) int64 {
+		raw, err := c.readFile(ctx, path.Join(cpufreqDir, name))
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			return 0
+		}
+		khz, _ := strconv.ParseInt(raw, 10, 64)
+		return khz / 1000
+	}
+	power.CPUFreqMHz = readKHz("scaling_cur_freq")
+	power.CPUMaxFreqMHz = readKHz("cpuinfo_max_freq")
+	power.CPUFreqLimitMHz = readKHz("scaling_max_freq")
+	if firstErr != nil && power.CPUFreqMHz == 0 && power.CPUMaxFreqMHz == 0 {
+		// cpufreq is always present on the Pis; failing here means the node is not answering
+		return nil, fmt.Errorf("failed to read cpufreq on %s: %w", nodeIP, firstErr)
+	}
+
+	if raw, err := c.readFile(ctx, getThrottled); err == nil {
+		if flags, err := strconv.ParseUint(strings.TrimPrefix(raw, "0x"), 16, 32); err == nil {
+			power.ThrottledFlags = fmt.Sprintf("0x%x", flags)
+			power.UnderVoltage = flags&throttleUnderVoltage != 0
+			power.FreqCapped = flags&throttleFreqCapped != 0
+			power.Throttled = flags&throttleThrottled != 0
+			power.SoftTempLimit = flags&throttleSoftTempLimit != 0
+			power.UnderVoltageOccurred = flags&throttleUnderVoltageOccurred != 0
+			power.FreqCappedOccurred = flags&throttleFreqCappedOccurred != 0
+			power.ThrottledOccurred = flags&throttleThrottledOccurred != 0
+			power.SoftTempLimitOccurred = flags&throttleSoftTempLimitOccurred != 0
+		}
+	}
+
+	if alarm, ok := c.rpiVoltAlarm(ctx); ok && alarm {
+		power.UnderVoltage = true
+	}
+
+	power.TripPoints = c.readTripPoints(ctx, cpuThermalZone)
+
+	return power, nil
+}
+
+// rpiVoltAlarm reads the under-voltage alarm of the rpi_volt hwmon device, if there is one
+func (c *Client) rpiVoltAlarm(ctx context.Context) (bool, bool) {
+	names, err := c.listDir(ctx, hwmonRoot)
+	if err != nil {
+		return false, false
+	}
+	for _, name := range names {
+		dir := path.Join(hwmonRoot, name)
+		if hwmonName, err := c.readFile(ctx, path.Join(dir, "name")); err != nil || hwmonName != rpiVoltHwmon {
+			continue
+		}
+		raw, err := c.readFile(ctx, path.Join(dir, "in0_lcrit_alarm"))
+		if err != nil {
+			return false, false
+		}
+		return raw == "1", true
+	}
+	return false, false
+}
+
+// readTripPoints reads trip_point_N_{type,temp,hyst} until the first missing index
+func (c *Client) readTripPoints(ctx context.Context, zone string) []metrics.TripPoint {
+	trips := []metrics.TripPoint{}
+	for i := 0; i < maxTripPoints; i++ {
+		prefix := path.Join(zone, fmt.Sprintf("trip_point_%d_", i))
+		tripType, err := c.readFile(ctx, prefix+"type")
+		if err != nil {
+			break
+		}
+		trip := metrics.TripPoint{Type: tripType}
+		if raw, err := c.readFile(ctx, prefix+"temp"); err == nil {
+			millidegrees, _ := strconv.ParseFloat(raw, 64)
+			trip.Temperature = millidegrees / 1000.0
+		}
+		if raw, err := c.readFile(ctx, prefix+"hyst"); err == nil {
+			millidegrees, _ := strconv.ParseFloat(raw, 64)
+			trip.Hysteresis = millidegrees / 1000.0
+		}
+		trips = append(trips, trip)
+	}
+	return trips
+}
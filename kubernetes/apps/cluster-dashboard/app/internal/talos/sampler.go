@@ -0,0 +1,40 @@
+package talos
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// StartSampler samples the block device and network interface counters of every
+// node now and then every interval until ctx is cancelled. Rates are computed
+// between samples, so they always span the same interval however often the
+// dashboard is refreshed.
+func (c *Client) StartSampler(ctx context.Context, interval time.Duration) {
+	if c.err != nil {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			var wg sync.WaitGroup
+			for _, node := range c.nodes {
+				wg.Add(1)
+				go func(node string) {
+					defer wg.Done()
+					c.sampleDiskIO(ctx, node)
+					c.sampleNetDev(ctx, node)
+				}(node)
+			}
+			wg.Wait()
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
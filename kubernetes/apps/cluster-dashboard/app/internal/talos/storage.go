@@ -0,0 +1,136 @@
+package talos
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cosi-project/runtime/pkg/safe"
+	"github.com/pi-cluster/cluster-dashboard/internal/metrics"
+	"github.com/siderolabs/talos/pkg/machinery/client"
+	"github.com/siderolabs/talos/pkg/machinery/resources/block"
+)
+
+// defaultStorageMounts are the mount points whose usage is reported: the EPHEMERAL
+// partition at /var and the extra disks from talos/patches/node-1x-storage.yaml
+// (Longhorn) and docs/03-storage-local-path.md (local-path-provisioner)
+var defaultStorageMounts = []string{"/var", "/var/mnt/longhorn", "/var/mnt/storage"}
+
+// defaultStorageWarnPercent is the fill percentage at which a mount raises a warning
+const defaultStorageWarnPercent = 80
+
+// ignoredDiskPrefixes are virtual block devices that are not worth listing
+var ignoredDiskPrefixes = []string{"loop", "ram", "zram", "nbd", "dm-"}
+
+// storageConfig reads STORAGE_MOUNTS (comma-separated) and STORAGE_WARN_PERCENT
+func storageConfig() ([]string, float64) {
+	mounts := defaultStorageMounts
+	if env := os.Getenv("STORAGE_MOUNTS"); env != "" {
+		mounts = nil
+		for _, mount := range strings.Split(env, ",") {
+			if mount = strings.TrimSpace(mount); mount != "" {
+				mounts = append(mounts, mount)
+			}
+		}
+	}
+
+	warn := float64(defaultStorageWarnPercent)
+	if percent, err := strconv.ParseFloat(os.Getenv("STORAGE_WARN_PERCENT"), 64); err == nil && percent > 0 {
+		warn = percent
+	}
+	return mounts, warn
+}
+
+// GetNodeStorage lists a node's disks and the usage of the watched mount points
+func (c *Client) GetNodeStorage(ctx context.Context, nodeIP string) (*metrics.NodeStorage, error) {
+	if c.err != nil {
+		return nil, fmt.Errorf("%w: %v", metrics.ErrTalosUnavailable, c.err)
+	}
+
+	ctx, cancel := context.WithTimeout(client.WithNode(ctx, nodeIP), nodeTimeout)
+	defer cancel()
+
+	storage := &metrics.NodeStorage{
+		Disks:    []metrics.Disk{},
+		Mounts:   []metrics.MountUsage{},
+		Warnings: []string{},
+	}
+
+	mounts, err := c.client.Mounts(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list mounts on %s: %w", nodeIP, err)
+	}
+	byMountPoint := make(map[string]metrics.MountUsage)
+	for _, msg := range mounts.GetMessages() {
+		for _, stat := range msg.GetStats() {
+			usage := metrics.MountUsage{
+				MountPoint: stat.GetMountedOn(),
+				Filesystem: stat.GetFilesystem(),
+				Size:       stat.GetSize(),
+				Available:  stat.GetAvailable(),
+			}
+			if usage.Size > usage.Available {
+				usage.Used = usage.Size - usage.Available
+			}
+			if usage.Size > 0 {
+				usage.UsedPercent = float64(usage.Used) / float64(usage.Size) * 100
+			}
+			byMountPoint[usage.MountPoint] = usage
+		}
+	}
+	for _, mountPoint := range c.storageMounts {
+		usage, ok := byMountPoint[mountPoint]
+		if !ok {
+			continue
+		}
+		if usage.UsedPercent >= c.storageWarnPercent {
+			usage.Warning = true
+			storage.Warnings = append(storage.Warnings, fmt.Sprintf("%s is %.0f%% full (warning at %.0f%%)", mountPoint, usage.UsedPercent, c.storageWarnPercent))
+		}
+		storage.Mounts = append(storage.Mounts, usage)
+	}
+
+	// Disks come from the block.Disk resources; a failure here still leaves the mounts
+	systemDisk := ""
+	if sd, err := safe.StateGet[*block.SystemDisk](ctx, c.client.COSI, block.NewSystemDisk(block.NamespaceName, block.SystemDiskID).Metadata()); err == nil {
+		systemDisk = sd.TypedSpec().DiskID
+	}
+	disks, err := safe.StateListAll[*block.Disk](ctx, c.client.COSI)
+	if err != nil {
+		storage.Error = fmt.Sprintf("failed to list disks: %v", err)
+		return storage, nil
+	}
+	for i := 0; i < disks.Len(); i++ {
+		disk := disks.Get(i)
+		spec := disk.TypedSpec()
+		if ignoredDisk(disk.Metadata().ID()) || spec.Size == 0 || spec.CDROM {
+			continue
+		}
+		storage.Disks = append(storage.Disks, metrics.Disk{
+			Name:       disk.Metadata().ID(),
+			DevPath:    spec.DevPath,
+			Model:      spec.Model,
+			Serial:     spec.Serial,
+			Size:       spec.Size,
+			Transport:  spec.Transport,
+			Rotational: spec.Rotational,
+			System:     disk.Metadata().ID() == systemDisk,
+		})
+	}
+	sort.Slice(storage.Disks, func(i, j int) bool { return storage.Disks[i].Name < storage.Disks[j].Name })
+
+	return storage, nil
+}
+
+// ignoredDisk reports whether a block device is virtual
+func ignoredDisk(name string) bool {
+	for _, prefix := range ignoredDiskPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
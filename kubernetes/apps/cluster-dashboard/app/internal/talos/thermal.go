@@ -0,0 +1,143 @@
+package talos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pi-cluster/cluster-dashboard/internal/metrics"
+	machineapi "github.com/siderolabs/talos/pkg/machinery/api/machine"
+	"github.com/siderolabs/talos/pkg/machinery/client"
+)
+
+// thermalRoot is the sysfs class holding thermal zones and cooling devices
+const thermalRoot = "/sys/class/thermal"
+
+// GetNodeThermals reads every thermal zone and cooling device of a node through the Talos Read API.
+// An error means the node could not be listed at all; individual read failures are
+// recorded on the zone or device.
+func (c *Client) GetNodeThermals(ctx context.Context, nodeIP string) (*metrics.NodeThermals, error) {
+	if c.err != nil {
+		return nil, fmt.Errorf("%w: %v", metrics.ErrTalosUnavailable, c.err)
+	}
+
+	ctx, cancel := context.WithTimeout(client.WithNode(ctx, nodeIP), nodeTimeout)
+	defer cancel()
+
+	names, err := c.listDir(ctx, thermalRoot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s on %s: %w", thermalRoot, nodeIP, err)
+	}
+
+	thermals := &metrics.NodeThermals{
+		Zones:          []metrics.ThermalZone{},
+		CoolingDevices: []metrics.CoolingDevice{},
+	}
+	for _, name := range names {
+		dir := path.Join(thermalRoot, name)
+		switch {
+		case strings.HasPrefix(name, "thermal_zone"):
+			thermals.Zones = append(thermals.Zones, c.readThermalZone(ctx, dir, name))
+		case strings.HasPrefix(name, "cooling_device"):
+			thermals.CoolingDevices = append(thermals.CoolingDevices, c.readCoolingDevice(ctx, dir, name))
+		}
+	}
+
+	return thermals, nil
+}
+
+// readThermalZone reads a zone's type and temperature (millidegrees Celsius)
+func (c *Client) readThermalZone(ctx context.Context, dir, name string) metrics.ThermalZone {
+	zone := metrics.ThermalZone{Name: name}
+	zone.Type, _ = c.readFile(ctx, path.Join(dir, "type"))
+
+	raw, err := c.readFile(ctx, path.Join(dir, "temp"))
+	if err != nil {
+		zone.Error = err.Error()
+		return zone
+	}
+	millidegrees, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		zone.Error = fmt.Sprintf("invalid temperature %q", raw)
+		return zone
+	}
+	zone.Temperature = millidegrees / 1000.0
+	return zone
+}
+
+// readCoolingDevice reads a cooling device's type and current/maximum state
+func (c *Client) readCoolingDevice(ctx context.Context, dir, name string) metrics.CoolingDevice {
+	device := metrics.CoolingDevice{Name: name}
+	device.Type, _ = c.readFile(ctx, path.Join(dir, "type"))
+
+	var errs []string
+	for _, field := range []struct {
+		file  string
+		value *int
+	}{
+		{"cur_state", &device.CurState},
+		{"max_state", &device.MaxState},
+	} {
+		raw, err := c.readFile(ctx, path.Join(dir, field.file))
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		if *field.value, err = strconv.Atoi(raw); err != nil {
+			errs = append(errs, fmt.Sprintf("invalid %s %q", field.file, raw))
+		}
+	}
+	device.Error = strings.Join(errs, "; ")
+	return device
+}
+
+// listDir returns the base names of the entries directly under root
+func (c *Client) listDir(ctx context.Context, root string) ([]string, error) {
+	stream, err := c.client.LS(ctx, &machineapi.ListRequest{Root: root})
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for {
+		info, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if msg := info.GetMetadata().GetError(); msg != "" {
+			return nil, errors.New(msg)
+		}
+		if info.GetError() != "" {
+			return nil, errors.New(info.GetError())
+		}
+		if info.GetRelativeName() == "." || info.GetName() == root {
+			continue
+		}
+		names = append(names, path.Base(info.GetName()))
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// readFile reads a small file such as a sysfs attribute and trims it
+func (c *Client) readFile(ctx context.Context, name string) (string, error) {
+	r, err := c.client.Read(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
@@ -0,0 +1,171 @@
+package talos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/cosi-project/runtime/pkg/safe"
+	"github.com/pi-cluster/cluster-dashboard/internal/metrics"
+	machineapi "github.com/siderolabs/talos/pkg/machinery/api/machine"
+	"github.com/siderolabs/talos/pkg/machinery/client"
+	"github.com/siderolabs/talos/pkg/machinery/config/encoder"
+	"github.com/siderolabs/talos/pkg/machinery/config/types/v1alpha1"
+	"github.com/siderolabs/talos/pkg/machinery/constants"
+	"github.com/siderolabs/talos/pkg/machinery/resources/config"
+)
+
+// installerRegistry serves the Image Factory installer images, as printed by create-schematic.sh
+const installerRegistry = "factory.talos.dev/installer"
+
+// InstallerRepository returns the installer image repository for the expected
+// schematic ID (talos/.schematic-id), or "" when none is mounted
+func (c *Client) InstallerRepository() string {
+	if c.err != nil {
+		return ""
+	}
+	_, schematicID, err := loadSchematic(c.expectedDir)
+	if err != nil || schematicID == "" {
+		return ""
+	}
+	return installerRegistry + "/" + schematicID
+}
+
+// GetNodeStatus queries one node the way GetTalosStatus does. Failures are
+// recorded on the node; the error is only set when Talos is not configured.
+func (c *Client) GetNodeStatus(ctx context.Context, nodeIP string) (*metrics.TalosNode, error) {
+	if c.err != nil {
+		return nil, fmt.Errorf("%w: %v", metrics.ErrTalosUnavailable, c.err)
+	}
+
+	status := c.nodeStatus(ctx, nodeIP)
+	return &status, nil
+}
+
+// CheckElevated reports why the elevated talosconfig that upgrades and power
+// actions use is not available, or nil when it is
+func (c *Client) CheckElevated() error {
+	_, err := c.elevatedClient()
+	return err
+}
+
+// UpgradeNode asks a node to install image and reboot into it, like
+// `talosctl upgrade --image`. It returns once the node has accepted the
+// request; the upgrade itself runs on the node. Uses the elevated talosconfig,
+// which needs the os:admin role.
+func (c *Client) UpgradeNode(ctx context.Context, nodeIP, image string) error {
+	elevated, err := c.elevatedClient()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(client.WithNode(ctx, nodeIP), nodeTimeout)
+	defer cancel()
+
+	_, err = elevated.UpgradeWithOptions(ctx,
+		client.WithUpgradeImage(image),
+		// Keep EPHEMERAL: on the Pis it holds etcd and local-path volumes on the same SD card
+		client.WithUpgradePreserve(true),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to upgrade %s (needs the os:admin role): %w", nodeIP, err)
+	}
+	return nil
+}
+
+// UpgradeKubernetes moves one Kubernetes component of a node to version through
+// its machine config, the way talosctl upgrade-k8s does: ComponentControlPlane
+// retags the API server, controller manager and scheduler of a control plane,
+// ComponentKubelet the kubelet. The config is applied without a reboot; Talos
+// restarts the component. Each image keeps its repository. Uses the elevated
+// talosconfig, which needs the os:admin role.
+func (c *Client) UpgradeKubernetes(ctx context.Context, nodeIP, component, version string) error {
+	elevated, err := c.elevatedClient()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(client.WithNode(ctx, nodeIP), nodeTimeout)
+	defer cancel()
+
+	current, err := safe.StateGet[*config.MachineConfig](ctx, elevated.COSI, config.NewMachineConfig(nil).Metadata())
+	if err != nil {
+		return fmt.Errorf("failed to read machine config on %s (needs the os:admin role): %w", nodeIP, err)
+	}
+	patched, err := current.Provider().PatchV1Alpha1(func(cfg *v1alpha1.Config) error {
+		return setKubernetesVersion(cfg, component, version)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to patch machine config of %s: %w", nodeIP, err)
+	}
+	data, err := patched.EncodeBytes(encoder.WithComments(encoder.CommentsDisabled))
+	if err != nil {
+		return fmt.Errorf("failed to encode machine config of %s: %w", nodeIP, err)
+	}
+
+	_, err = elevated.ApplyConfiguration(ctx, &machineapi.ApplyConfigurationRequest{
+		Data: data,
+		Mode: machineapi.ApplyConfigurationRequest_NO_REBOOT,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to apply %s %s to %s: %w", component, version, nodeIP, err)
+	}
+	return nil
+}
+
+// setKubernetesVersion retags the images of one Kubernetes component in a machine config
+func setKubernetesVersion(cfg *v1alpha1.Config, component, version string) error {
+	switch component {
+	case metrics.ComponentKubelet:
+		if cfg.MachineConfig == nil {
+			return errors.New("machine config has no machine section")
+		}
+		if cfg.MachineConfig.MachineKubelet == nil {
+			cfg.MachineConfig.MachineKubelet = &v1alpha1.KubeletConfig{}
+		}
+		kubelet := cfg.MachineConfig.MachineKubelet
+		kubelet.KubeletImage = retag(kubelet.KubeletImage, constants.KubeletImage, version)
+		return nil
+
+	case metrics.ComponentControlPlane:
+		if !cfg.Machine().Type().IsControlPlane() || cfg.ClusterConfig == nil {
+			return errors.New("not a control plane")
+		}
+		cluster := cfg.ClusterConfig
+		if cluster.APIServerConfig == nil {
+			cluster.APIServerConfig = &v1alpha1.APIServerConfig{}
+		}
+		cluster.APIServerConfig.ContainerImage = retag(cluster.APIServerConfig.ContainerImage, constants.KubernetesAPIServerImage, version)
+		if cluster.ControllerManagerConfig == nil {
+			cluster.ControllerManagerConfig = &v1alpha1.ControllerManagerConfig{}
+		}
+		cluster.ControllerManagerConfig.ContainerImage = retag(cluster.ControllerManagerConfig.ContainerImage, constants.KubernetesControllerManagerImage, version)
+		if cluster.SchedulerConfig == nil {
+			cluster.SchedulerConfig = &v1alpha1.SchedulerConfig{}
+		}
+		cluster.SchedulerConfig.ContainerImage = retag(cluster.SchedulerConfig.ContainerImage, constants.KubernetesSchedulerImage, version)
+		// The DaemonSet itself is updated through the Kubernetes API; this keeps
+		// the manifest Talos renders for it in step
+		if cluster.ProxyConfig == nil {
+			cluster.ProxyConfig = &v1alpha1.ProxyConfig{}
+		}
+		cluster.ProxyConfig.ContainerImage = retag(cluster.ProxyConfig.ContainerImage, constants.KubeProxyImage, version)
+		return nil
+	}
+	return fmt.Errorf("%s is not upgraded through the machine config", component)
+}
+
+// retag returns image, or repository when image is unset, tagged with version
+func retag(image, repository, version string) string {
+	if image != "" {
+		if i := strings.Index(image, "@"); i >= 0 {
+			image = image[:i]
+		}
+		if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+			image = image[:i]
+		}
+		repository = image
+	}
+	return repository + ":" + version
+}
@@ -0,0 +1,115 @@
+package talos
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cosi-project/runtime/pkg/safe"
+	"github.com/pi-cluster/cluster-dashboard/internal/metrics"
+	"github.com/siderolabs/talos/pkg/machinery/resources/network"
+)
+
+// defaultVIP is the shared API server address from docs/talos-vip-rebuild.md
+const defaultVIP = "192.168.1.10"
+
+// maxVIPMoves is how many holder changes are kept
+const maxVIPMoves = 20
+
+// vipTracker remembers the last VIP holders so moves can be recorded between collections
+type vipTracker struct {
+	mu      sync.Mutex
+	address netip.Addr
+	holders string // Comma-separated hostnames at the last collection, "none" when nobody held it
+	seen    bool
+	moves   []metrics.VIPMove
+}
+
+// newVIPTracker reads the VIP from TALOS_VIP, falling back to defaultVIP
+func newVIPTracker() *vipTracker {
+	raw := os.Getenv("TALOS_VIP")
+	if raw == "" {
+		raw = defaultVIP
+	}
+	address, err := netip.ParseAddr(raw)
+	if err != nil {
+		log.Printf("Warning: invalid TALOS_VIP %q, VIP tracking disabled: %v", raw, err)
+	}
+	return &vipTracker{address: address}
+}
+
+// holdsVIP reports whether the VIP is among the node's addresses
+func (c *Client) holdsVIP(ctx context.Context) (bool, error) {
+	addresses, err := safe.StateListAll[*network.AddressStatus](ctx, c.client.COSI)
+	if err != nil {
+		return false, err
+	}
+	for i := 0; i < addresses.Len(); i++ {
+		if addresses.Get(i).TypedSpec().Address.Addr() == c.vip.address {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// observe records the holders seen in this collection, notes a move when they
+// changed since the last one and warns when the VIP is not held by exactly one node
+func (t *vipTracker) observe(nodes []metrics.TalosNode) metrics.VIPStatus {
+	status := metrics.VIPStatus{
+		Address: t.address.String(),
+		Holders: []string{},
+	}
+
+	unreachable := 0
+	for _, node := range nodes {
+		if !node.Reachable {
+			unreachable++
+		}
+		if node.HoldsVIP {
+			name := node.Hostname
+			if name == "" {
+				name = node.Node
+			}
+			status.Holders = append(status.Holders, name)
+		}
+	}
+
+	switch {
+	case len(status.Holders) == 0 && unreachable > 0:
+		status.Warning = fmt.Sprintf("no reachable node holds the VIP %s (%d unreachable)", status.Address, unreachable)
+	case len(status.Holders) == 0:
+		status.Warning = fmt.Sprintf("no node holds the VIP %s: the API server endpoint is down", status.Address)
+	case len(status.Holders) > 1:
+		status.Warning = fmt.Sprintf("VIP %s is held by %d nodes (%s): split brain on the control plane network",
+			status.Address, len(status.Holders), strings.Join(status.Holders, ", "))
+	}
+
+	holders := strings.Join(status.Holders, ", ")
+	if holders == "" {
+		holders = "none"
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	// Nobody answering for the VIP says nothing about who holds it, so an API
+	// blip must not show up as a move to "none" and back
+	if unreachable > 0 && len(status.Holders) == 0 {
+		status.Moves = append([]metrics.VIPMove{}, t.moves...)
+		return status
+	}
+	if t.seen && holders != t.holders {
+		t.moves = append([]metrics.VIPMove{{Time: time.Now(), From: t.holders, To: holders}}, t.moves...)
+		if len(t.moves) > maxVIPMoves {
+			t.moves = t.moves[:maxVIPMoves]
+		}
+	}
+	t.holders = holders
+	t.seen = true
+	status.Moves = append([]metrics.VIPMove{}, t.moves...)
+	return status
+}
@@ -0,0 +1,924 @@
+package upgrade
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pi-cluster/cluster-dashboard/internal/metrics"
+)
+
+// Timings of a run, variables so tests can shorten them
+var (
+	pollInterval  = 10 * time.Second
+	gateTimeout   = 5 * time.Minute  // How long the health gate waits for the cluster to settle
+	drainTimeout  = 10 * time.Minute // Longhorn replicas can take a while to satisfy their PDBs
+	rejoinTimeout = 20 * time.Minute // The Pis pull the installer and reboot from SD, which is slow
+)
+
+// controlPlaneComponents are the static pods a Kubernetes control plane step restarts
+var controlPlaneComponents = []string{"kube-apiserver", "kube-controller-manager", "kube-scheduler"}
+
+const (
+	saveTimeout   = 10 * time.Second // Progress writes give up after this; the next one catches up
+	leaseDuration = 5 * time.Minute  // Outlasts the API outage while a control plane reboots
+	renewInterval = 30 * time.Second
+	maxEvents     = 100
+)
+
+// ErrInvalidState is returned when an action does not apply to the current run,
+// e.g. starting a second upgrade while one is paused
+var ErrInvalidState = errors.New("not allowed in the current upgrade state")
+
+// errAborted stops a run that was aborted, possibly from another replica, or
+// that another replica took over
+var errAborted = errors.New("upgrade aborted")
+
+// errLeaseLost stops a run whose owner could not renew its lease in time
+var errLeaseLost = errors.New("upgrade lease lost")
+
+// Kubernetes is the cluster access the orchestrator needs
+type Kubernetes interface {
+	GetNodeMetrics(ctx context.Context) ([]metrics.NodeDetail, error)
+	CordonNode(ctx context.Context, name string, cordon bool) error
+	DrainNode(ctx context.Context, name string, progress func(remaining []string)) error
+	ControlPlaneVersions(ctx context.Context, node string) (map[string]string, error)
+	KubeProxyVersion(ctx context.Context) (version string, rolledOut bool, err error)
+	SetKubeProxyVersion(ctx context.Context, version string) error
+}
+
+// Talos is the Talos API access the orchestrator needs. Tests can put a fake
+// Talos API server behind it.
+type Talos interface {
+	GetNodeStatus(ctx context.Context, nodeIP string) (*metrics.TalosNode, error)
+	GetEtcdStatus(ctx context.Context) (*metrics.EtcdStatus, error)
+	UpgradeNode(ctx context.Context, nodeIP, image string) error
+	UpgradeKubernetes(ctx context.Context, nodeIP, component, version string) error
+	CheckElevated() error
+}
+
+// Store persists the current run and the lease on executing it. Only the
+// replica holding the lease executes the run, and a run left Running is only
+// taken as interrupted once the lease has expired.
+type Store interface {
+	LoadUpgradeRun(ctx context.Context) (*metrics.UpgradeRun, error)
+	SaveUpgradeRun(ctx context.Context, run *metrics.UpgradeRun) error
+	AcquireUpgradeLease(ctx context.Context, holder string, duration time.Duration) error
+	ReleaseUpgradeLease(ctx context.Context, holder string) error
+	UpgradeLeaseHolder(ctx context.Context) (string, error)
+}
+
+// Orchestrator plans and runs rolling Talos and Kubernetes upgrades, one node
+// at a time with a health gate between nodes. The run lives in the Store, so every replica shows
+// the same progress and a run interrupted by a restart can be resumed.
+type Orchestrator struct {
+	kube  Kubernetes
+	talos Talos
+	store Store
+	owner string          // This replica, recorded on the runs it executes
+	node  string          // Node this replica runs on, if known
+	ctx   context.Context // Runs stop when it is cancelled
+
+	mu     sync.Mutex         // Serialises changes to the stored run made by this replica
+	cancel context.CancelFunc // Set while this replica executes a run
+}
+
+// NewOrchestrator creates an orchestrator. Runs started on it stop when ctx is cancelled.
+// The replica is identified by POD_NAME and its node by NODE_NAME.
+func NewOrchestrator(ctx context.Context, kube Kubernetes, talos Talos, store Store) *Orchestrator {
+	owner := os.Getenv("POD_NAME")
+	if owner == "" {
+		owner, _ = os.Hostname()
+	}
+	return &Orchestrator{
+		kube:  kube,
+		talos: talos,
+		store: store,
+		owner: owner,
+		node:  os.Getenv("NODE_NAME"),
+		ctx:   ctx,
+	}
+}
+
+// Current returns the stored run, or nil when there is none. A running upgrade
+// whose owner's lease has expired is marked paused so it can be resumed.
+func (o *Orchestrator) Current(ctx context.Context) (*metrics.UpgradeRun, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.current(ctx)
+}
+
+func (o *Orchestrator) current(ctx context.Context) (*metrics.UpgradeRun, error) {
+	run, err := o.store.LoadUpgradeRun(ctx)
+	if err != nil || run == nil {
+		return run, err
+	}
+	if run.State != metrics.UpgradeRunning || o.cancel != nil {
+		return run, nil
+	}
+	holder, err := o.store.UpgradeLeaseHolder(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if holder == "" {
+		run.State = metrics.UpgradePaused
+		run.Message = fmt.Sprintf("Interrupted: %s stopped holding the upgrade lease, its last progress was at %s. Check the node that was in progress, then resume.",
+			run.Owner, run.Heartbeat.Format(time.RFC3339))
+		addEvent(run, "", run.Message)
+		if err := o.store.SaveUpgradeRun(ctx, run); err != nil {
+			return nil, err
+		}
+	}
+	return run, nil
+}
+
+// Preview plans an upgrade to the Talos installer image and/or the Kubernetes
+// version and stores it without touching any node. Either may be empty, not
+// both. A planned run may be replaced; a running or paused one has to be
+// aborted first.
+func (o *Orchestrator) Preview(ctx context.Context, image, kubernetes, user string) (*metrics.UpgradeRun, error) {
+	image = strings.TrimSpace(image)
+	kubernetes = strings.TrimSpace(kubernetes)
+	if image == "" && kubernetes == "" {
+		return nil, fmt.Errorf("%w: give an installer image, a Kubernetes version or both", ErrInvalidImage)
+	}
+	var target string
+	if image != "" {
+		var err error
+		if target, err = imageVersion(image); err != nil {
+			return nil, err
+		}
+	}
+	if kubernetes != "" {
+		var err error
+		if kubernetes, err = kubernetesVersion(kubernetes); err != nil {
+			return nil, err
+		}
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	current, err := o.current(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if current != nil && (current.State == metrics.UpgradeRunning || current.State == metrics.UpgradePaused) {
+		return nil, fmt.Errorf("%w: an upgrade to %s is %s", ErrInvalidState, Targets(current), strings.ToLower(current.State))
+	}
+
+	run, err := o.plan(ctx, image, target, kubernetes)
+	if err != nil {
+		return nil, err
+	}
+	run.CreatedBy = user
+	addEvent(run, "", fmt.Sprintf("Planned by %s", user))
+	if err := o.store.SaveUpgradeRun(ctx, run); err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+// Targets describes what a run upgrades to, e.g. "Talos v1.11.6 and Kubernetes v1.34.1"
+func Targets(run *metrics.UpgradeRun) string {
+	var targets []string
+	if run.TargetVersion != "" {
+		targets = append(targets, "Talos "+run.TargetVersion)
+	}
+	if run.KubernetesVersion != "" {
+		targets = append(targets, "Kubernetes "+run.KubernetesVersion)
+	}
+	return strings.Join(targets, " and ")
+}
+
+// plan orders the nodes: workers first, then control planes one at a time with
+// the etcd leader last so leadership moves only once. Talos steps come first,
+// then the Kubernetes steps.
+func (o *Orchestrator) plan(ctx context.Context, image, target, kubernetes string) (*metrics.UpgradeRun, error) {
+	nodes, err := o.kube.GetNodeMetrics(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+
+	run := &metrics.UpgradeRun{
+		ID:                time.Now().UTC().Format("20060102-150405"),
+		Image:             image,
+		TargetVersion:     target,
+		KubernetesVersion: kubernetes,
+		State:             metrics.UpgradePlanned,
+		Steps:             []metrics.UpgradeStep{},
+		Warnings:          []string{},
+		CreatedAt:         time.Now(),
+		Events:            []metrics.UpgradeEvent{},
+	}
+
+	var leader string
+	if etcd, err := o.talos.GetEtcdStatus(ctx); err != nil {
+		run.Warnings = append(run.Warnings, fmt.Sprintf("etcd status unavailable, control planes are upgraded in name order: %v", err))
+	} else {
+		leader = etcd.Leader
+	}
+
+	sort.Slice(nodes, func(i, j int) bool {
+		a, b := nodes[i], nodes[j]
+		if (a.Role == "control-plane") != (b.Role == "control-plane") {
+			return b.Role == "control-plane"
+		}
+		if (a.Name == leader) != (b.Name == leader) {
+			return b.Name == leader
+		}
+		return a.Name < b.Name
+	})
+
+	controlPlanes := 0
+	for _, node := range nodes {
+		if node.IP == "" {
+			return nil, fmt.Errorf("node %s has no internal IP to reach Talos on", node.Name)
+		}
+		if node.Role == "control-plane" {
+			controlPlanes++
+		}
+	}
+
+	if image != "" {
+		if err := o.planTalos(ctx, run, nodes); err != nil {
+			return nil, err
+		}
+	}
+	if kubernetes != "" {
+		if err := o.planKubernetes(ctx, run, nodes); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(run.Steps) == 0 {
+		return nil, errors.New("no nodes to upgrade")
+	}
+	if controlPlanes < 3 {
+		outage := "reboots"
+		if image == "" {
+			outage = "restarts its API server"
+		}
+		run.Warnings = append(run.Warnings, fmt.Sprintf("only %d control planes: the Kubernetes API is unavailable while one %s", controlPlanes, outage))
+	}
+	if o.node != "" {
+		run.Warnings = append(run.Warnings, fmt.Sprintf("this dashboard replica runs on %s: if it is evicted the run pauses and can be resumed from the other replica", o.node))
+	}
+	return run, nil
+}
+
+// planTalos adds a Talos step per node, in the planned node order
+func (o *Orchestrator) planTalos(ctx context.Context, run *metrics.UpgradeRun, nodes []metrics.NodeDetail) error {
+	for _, node := range nodes {
+		step := metrics.UpgradeStep{
+			Component: metrics.ComponentTalos,
+			Node:      node.Name,
+			IP:        node.IP,
+			Role:      node.Role,
+			Phase:     metrics.PhasePending,
+		}
+		status, err := o.talos.GetNodeStatus(ctx, node.IP)
+		switch {
+		case err != nil:
+			return err
+		case !status.Reachable:
+			run.Warnings = append(run.Warnings, fmt.Sprintf("%s: Talos API not reachable: %s", node.Name, status.Error))
+		default:
+			step.FromVersion = status.Version
+			if warning := versionWarning(status.Version, run.TargetVersion); warning != "" {
+				run.Warnings = append(run.Warnings, fmt.Sprintf("%s: %s", node.Name, warning))
+			}
+		}
+		if step.FromVersion == run.TargetVersion {
+			step.Phase = metrics.PhaseDone
+			step.Message = "already runs " + run.TargetVersion
+		}
+		run.Steps = append(run.Steps, step)
+	}
+	return nil
+}
+
+// planKubernetes adds the Kubernetes steps in the order talosctl upgrade-k8s
+// uses: the control plane components of each control plane, kube-proxy, then
+// the kubelet of each control plane and each worker
+func (o *Orchestrator) planKubernetes(ctx context.Context, run *metrics.UpgradeRun, nodes []metrics.NodeDetail) error {
+	target := run.KubernetesVersion
+	addStep := func(step metrics.UpgradeStep) {
+		step.Phase = metrics.PhasePending
+		if step.FromVersion == target {
+			step.Phase = metrics.PhaseDone
+			step.Message = "already runs " + target
+		}
+		run.Steps = append(run.Steps, step)
+	}
+
+	var controlPlanes, workers []metrics.NodeDetail
+	for _, node := range nodes {
+		if node.Role == "control-plane" {
+			controlPlanes = append(controlPlanes, node)
+		} else {
+			workers = append(workers, node)
+		}
+	}
+
+	for _, node := range controlPlanes {
+		versions, err := o.kube.ControlPlaneVersions(ctx, node.Name)
+		if err != nil {
+			return fmt.Errorf("failed to read the control plane versions of %s: %w", node.Name, err)
+		}
+		from := controlPlaneVersion(versions)
+		if from == "" {
+			run.Warnings = append(run.Warnings, fmt.Sprintf("%s: control plane components not all Ready: %s", node.Name, formatVersions(versions)))
+		} else if warning := versionWarning(from, target); warning != "" {
+			run.Warnings = append(run.Warnings, fmt.Sprintf("%s: Kubernetes %s", node.Name, warning))
+		}
+		addStep(metrics.UpgradeStep{Component: metrics.ComponentControlPlane, Node: node.Name, IP: node.IP, Role: node.Role, FromVersion: from})
+	}
+
+	from, _, err := o.kube.KubeProxyVersion(ctx)
+	if err != nil {
+		return err
+	}
+	if from != "" {
+		addStep(metrics.UpgradeStep{Component: metrics.ComponentKubeProxy, Node: "kube-proxy", Role: "DaemonSet", FromVersion: from})
+	}
+
+	for _, node := range append(controlPlanes, workers...) {
+		addStep(metrics.UpgradeStep{Component: metrics.ComponentKubelet, Node: node.Name, IP: node.IP, Role: node.Role, FromVersion: node.KubeletVersion})
+	}
+	return nil
+}
+
+// controlPlaneVersion returns the version every control plane component of a
+// node runs, or "" when they differ or one is not Ready
+func controlPlaneVersion(versions map[string]string) string {
+	if len(versions) < len(controlPlaneComponents) {
+		return ""
+	}
+	version := ""
+	for _, v := range versions {
+		if version != "" && v != version {
+			return ""
+		}
+		version = v
+	}
+	return version
+}
+
+// formatVersions lists component versions in name order
+func formatVersions(versions map[string]string) string {
+	var parts []string
+	for _, name := range controlPlaneComponents {
+		v := versions[name]
+		if v == "" {
+			v = "not Ready"
+		}
+		parts = append(parts, name+" "+v)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Start runs the planned upgrade, or resumes a paused one from the step that failed
+func (o *Orchestrator) Start(ctx context.Context, user string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	run, err := o.current(ctx)
+	if err != nil {
+		return err
+	}
+	if run == nil {
+		return fmt.Errorf("%w: no upgrade is planned", ErrInvalidState)
+	}
+	if run.State != metrics.UpgradePlanned && run.State != metrics.UpgradePaused {
+		return fmt.Errorf("%w: the upgrade is %s", ErrInvalidState, strings.ToLower(run.State))
+	}
+	if o.cancel != nil {
+		return fmt.Errorf("%w: the previous run is still stopping", ErrInvalidState)
+	}
+	// Checked before any node is cordoned: without it every upgrade call fails
+	if err := o.talos.CheckElevated(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidState, err)
+	}
+	if err := o.store.AcquireUpgradeLease(ctx, o.owner, leaseDuration); err != nil {
+		if errors.Is(err, metrics.ErrLeaseHeld) {
+			return fmt.Errorf("%w: %v", ErrInvalidState, err)
+		}
+		return err
+	}
+
+	verb := "Started"
+	if run.State == metrics.UpgradePaused {
+		verb = "Resumed"
+	}
+	run.State = metrics.UpgradeRunning
+	run.Owner = o.owner
+	run.Message = ""
+	run.Heartbeat = time.Now()
+	if run.StartedAt.IsZero() {
+		run.StartedAt = time.Now()
+	}
+	addEvent(run, "", fmt.Sprintf("%s by %s on %s", verb, user, o.owner))
+	if err := o.store.SaveUpgradeRun(ctx, run); err != nil {
+		o.releaseLease()
+		return err
+	}
+
+	runCtx, cancel := context.WithCancelCause(o.ctx)
+	o.cancel = func() { cancel(nil) }
+	go o.holdLease(runCtx, cancel)
+	go o.execute(runCtx, run)
+	return nil
+}
+
+// holdLease renews the lease while the run executes. Failed renewals are
+// retried on the next tick; if none succeeds before the lease could expire the
+// run is stopped, since another replica may then take it over.
+func (o *Orchestrator) holdLease(ctx context.Context, cancel context.CancelCauseFunc) {
+	renewed := time.Now()
+	ticker := time.NewTicker(renewInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		renewCtx, cancelRenew := context.WithTimeout(ctx, saveTimeout)
+		err := o.store.AcquireUpgradeLease(renewCtx, o.owner, leaseDuration)
+		cancelRenew()
+		if err == nil {
+			renewed = time.Now()
+			continue
+		}
+		log.Printf("Warning: failed to renew the upgrade lease: %v", err)
+		if errors.Is(err, metrics.ErrLeaseHeld) || time.Since(renewed) > leaseDuration-renewInterval {
+			cancel(errLeaseLost)
+			return
+		}
+	}
+}
+
+// releaseLease gives up the lease once this replica stops executing
+func (o *Orchestrator) releaseLease() {
+	ctx, cancel := context.WithTimeout(context.Background(), saveTimeout)
+	defer cancel()
+	if err := o.store.ReleaseUpgradeLease(ctx, o.owner); err != nil {
+		log.Printf("Warning: failed to release the upgrade lease, it expires in %s: %v", leaseDuration, err)
+	}
+}
+
+// Abort stops the run. A node that was in progress is left as it is, possibly cordoned.
+func (o *Orchestrator) Abort(ctx context.Context, user string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	run, err := o.current(ctx)
+	if err != nil {
+		return err
+	}
+	if run == nil || run.State == metrics.UpgradeCompleted || run.State == metrics.UpgradeAborted {
+		return fmt.Errorf("%w: there is no upgrade to abort", ErrInvalidState)
+	}
+
+	run.State = metrics.UpgradeAborted
+	run.FinishedAt = time.Now()
+	run.Message = "Aborted by " + user
+	for _, step := range run.Steps {
+		if step.Phase != metrics.PhasePending && step.Phase != metrics.PhaseDone {
+			run.Message += fmt.Sprintf(". %s of %s was left at %q", stepComponent(step), step.Node, step.Phase)
+			if stepComponent(step) == metrics.ComponentTalos {
+				run.Message += " and may still be cordoned"
+			}
+		}
+	}
+	addEvent(run, "", run.Message)
+	if err := o.store.SaveUpgradeRun(ctx, run); err != nil {
+		return err
+	}
+	if o.cancel != nil {
+		o.cancel()
+	}
+	return nil
+}
+
+// execute upgrades the remaining nodes in order and pauses at the first failure
+func (o *Orchestrator) execute(ctx context.Context, run *metrics.UpgradeRun) {
+	defer func() {
+		o.mu.Lock()
+		o.cancel()
+		o.cancel = nil
+		o.mu.Unlock()
+		o.releaseLease()
+	}()
+
+	for i := range run.Steps {
+		step := &run.Steps[i]
+		if step.Phase == metrics.PhaseDone {
+			continue
+		}
+
+		var err error
+		if stepComponent(*step) == metrics.ComponentTalos {
+			err = o.upgradeNode(ctx, run, i)
+		} else {
+			err = o.upgradeKubernetes(ctx, run, i)
+		}
+		if errors.Is(err, errAborted) {
+			log.Printf("upgrade %s: stopped, it was aborted", run.ID)
+			return
+		}
+		if err != nil {
+			step.Failed = true
+			step.Message = err.Error()
+			run.State = metrics.UpgradePaused
+			switch {
+			case o.ctx.Err() != nil:
+				run.Message = fmt.Sprintf("Interrupted by dashboard shutdown at %s of %s %s. Resume to retry it.", step.Phase, stepComponent(*step), step.Node)
+			case errors.Is(context.Cause(ctx), errLeaseLost):
+				run.Message = fmt.Sprintf("Interrupted at %s of %s %s: %s could not renew the upgrade lease. Check the node, then resume to retry it.", step.Phase, stepComponent(*step), step.Node, o.owner)
+			default:
+				run.Message = fmt.Sprintf("Paused: %s of %s %s failed: %v. Fix the cause, then resume to retry it.", step.Phase, stepComponent(*step), step.Node, err)
+			}
+			addEvent(run, step.Node, run.Message)
+			o.saveFinal(run)
+			return
+		}
+	}
+
+	run.State = metrics.UpgradeCompleted
+	run.FinishedAt = time.Now()
+	run.Message = fmt.Sprintf("Every node runs %s", Targets(run))
+	addEvent(run, "", run.Message)
+	o.saveFinal(run)
+}
+
+// upgradeNode takes one node through every phase. Each phase can be repeated,
+// so a resumed step simply starts again from the health gate.
+func (o *Orchestrator) upgradeNode(ctx context.Context, run *metrics.UpgradeRun, i int) error {
+	step := &run.Steps[i]
+	step.Failed = false
+	if step.StartedAt.IsZero() {
+		step.StartedAt = time.Now()
+	}
+
+	if err := o.enter(run, i, metrics.PhaseGate, "waiting for every node to be Ready and etcd healthy"); err != nil {
+		return err
+	}
+	if err := o.waitFor(ctx, run, i, gateTimeout, o.clusterHealth); err != nil {
+		return err
+	}
+
+	if err := o.enter(run, i, metrics.PhaseCordon, ""); err != nil {
+		return err
+	}
+	if err := o.kube.CordonNode(ctx, step.Node, true); err != nil {
+		return err
+	}
+
+	if err := o.enter(run, i, metrics.PhaseDrain, "evicting pods"); err != nil {
+		return err
+	}
+	drainCtx, cancel := context.WithTimeout(ctx, drainTimeout)
+	err := o.kube.DrainNode(drainCtx, step.Node, func(remaining []string) {
+		step.Message = fmt.Sprintf("%d pods left: %s", len(remaining), strings.Join(remaining, ", "))
+		if errors.Is(o.save(run), errAborted) {
+			cancel()
+		}
+	})
+	cancel()
+	if err != nil {
+		return err
+	}
+
+	status, err := o.talos.GetNodeStatus(ctx, step.IP)
+	if err != nil {
+		return err
+	}
+	if status.Version == run.TargetVersion {
+		// Resumed after the node had already rebooted into the new version
+		addEvent(run, step.Node, "already runs "+run.TargetVersion+", not upgrading it again")
+	} else {
+		if err := o.enter(run, i, metrics.PhaseUpgrade, "installing "+run.Image); err != nil {
+			return err
+		}
+		if err := o.talos.UpgradeNode(ctx, step.IP, run.Image); err != nil {
+			return err
+		}
+	}
+
+	if err := o.enter(run, i, metrics.PhaseRejoin, "waiting for the node to reboot"); err != nil {
+		return err
+	}
+	rejoined := func(ctx context.Context) error {
+		return o.nodeRejoined(ctx, run, step)
+	}
+	if err := o.waitFor(ctx, run, i, rejoinTimeout, rejoined); err != nil {
+		return err
+	}
+
+	if err := o.enter(run, i, metrics.PhaseUncordon, ""); err != nil {
+		return err
+	}
+	if err := o.kube.CordonNode(ctx, step.Node, false); err != nil {
+		return err
+	}
+
+	step.FinishedAt = time.Now()
+	message := fmt.Sprintf("upgraded from %s to %s in %s", step.FromVersion, run.TargetVersion, step.FinishedAt.Sub(step.StartedAt).Round(time.Second))
+	return o.enter(run, i, metrics.PhaseDone, message)
+}
+
+// upgradeKubernetes takes one Kubernetes step through the health gate, the
+// upgrade and the wait for the new version. Nothing is cordoned: the
+// components restart in place. Like upgradeNode, a resumed step starts again
+// from the health gate.
+func (o *Orchestrator) upgradeKubernetes(ctx context.Context, run *metrics.UpgradeRun, i int) error {
+	step := &run.Steps[i]
+	step.Failed = false
+	if step.StartedAt.IsZero() {
+		step.StartedAt = time.Now()
+	}
+	target := run.KubernetesVersion
+
+	if err := o.enter(run, i, metrics.PhaseGate, "waiting for every node to be Ready and etcd healthy"); err != nil {
+		return err
+	}
+	if err := o.waitFor(ctx, run, i, gateTimeout, o.clusterHealth); err != nil {
+		return err
+	}
+
+	current, err := o.kubernetesVersion(ctx, step)
+	if err != nil {
+		return err
+	}
+	if current == target {
+		// Resumed after the component had already been upgraded
+		addEvent(run, step.Node, fmt.Sprintf("%s already runs %s, not upgrading it again", step.Component, target))
+	} else {
+		if err := o.enter(run, i, metrics.PhaseUpgrade, fmt.Sprintf("moving %s to %s", step.Component, target)); err != nil {
+			return err
+		}
+		if step.Component == metrics.ComponentKubeProxy {
+			err = o.kube.SetKubeProxyVersion(ctx, target)
+		} else {
+			err = o.talos.UpgradeKubernetes(ctx, step.IP, step.Component, target)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := o.enter(run, i, metrics.PhaseRejoin, fmt.Sprintf("waiting for %s to run %s", step.Component, target)); err != nil {
+		return err
+	}
+	upgraded := func(ctx context.Context) error {
+		version, err := o.kubernetesVersion(ctx, step)
+		if err != nil {
+			return err
+		}
+		if version != target {
+			return fmt.Errorf("%s still runs %s", step.Component, version)
+		}
+		return o.clusterHealth(ctx)
+	}
+	if err := o.waitFor(ctx, run, i, rejoinTimeout, upgraded); err != nil {
+		return err
+	}
+
+	step.FinishedAt = time.Now()
+	message := fmt.Sprintf("upgraded from %s to %s in %s", step.FromVersion, target, step.FinishedAt.Sub(step.StartedAt).Round(time.Second))
+	return o.enter(run, i, metrics.PhaseDone, message)
+}
+
+// kubernetesVersion returns the version a Kubernetes step's component runs
+// once it is fully up: every control plane component Ready on that version,
+// the kube-proxy DaemonSet rolled out, or the node's kubelet reporting it
+func (o *Orchestrator) kubernetesVersion(ctx context.Context, step *metrics.UpgradeStep) (string, error) {
+	switch step.Component {
+	case metrics.ComponentControlPlane:
+		versions, err := o.kube.ControlPlaneVersions(ctx, step.Node)
+		if err != nil {
+			return "", err
+		}
+		if version := controlPlaneVersion(versions); version != "" {
+			return version, nil
+		}
+		return formatVersions(versions), nil
+
+	case metrics.ComponentKubeProxy:
+		version, rolledOut, err := o.kube.KubeProxyVersion(ctx)
+		if err != nil {
+			return "", err
+		}
+		if !rolledOut {
+			return version + ", rollout in progress", nil
+		}
+		return version, nil
+
+	case metrics.ComponentKubelet:
+		nodes, err := o.kube.GetNodeMetrics(ctx)
+		if err != nil {
+			return "", fmt.Errorf("failed to list nodes: %w", err)
+		}
+		for _, node := range nodes {
+			if node.Name == step.Node {
+				return node.KubeletVersion, nil
+			}
+		}
+		return "", fmt.Errorf("node %s not found", step.Node)
+	}
+	return "", fmt.Errorf("unknown upgrade component %q", step.Component)
+}
+
+// stepComponent returns what a step upgrades; runs stored before Kubernetes
+// upgrades have no component on their Talos steps
+func stepComponent(step metrics.UpgradeStep) string {
+	if step.Component == "" {
+		return metrics.ComponentTalos
+	}
+	return step.Component
+}
+
+// clusterHealth is the gate between nodes: every node Ready and etcd healthy with
+// a member per control plane, so taking one more member down keeps quorum
+func (o *Orchestrator) clusterHealth(ctx context.Context) error {
+	nodes, err := o.kube.GetNodeMetrics(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list nodes: %w", err)
+	}
+	var notReady []string
+	controlPlanes := 0
+	for _, node := range nodes {
+		if !node.IsReady {
+			notReady = append(notReady, node.Name)
+		}
+		if node.Role == "control-plane" {
+			controlPlanes++
+		}
+	}
+	if len(notReady) > 0 {
+		sort.Strings(notReady)
+		return fmt.Errorf("nodes not Ready: %s", strings.Join(notReady, ", "))
+	}
+
+	etcd, err := o.talos.GetEtcdStatus(ctx)
+	if err != nil {
+		return fmt.Errorf("etcd status unavailable: %w", err)
+	}
+	if !etcd.Healthy {
+		return fmt.Errorf("etcd is not healthy: %s", strings.Join(etcd.Warnings, "; "))
+	}
+	if len(etcd.Members) < controlPlanes {
+		return fmt.Errorf("etcd has %d members for %d control planes", len(etcd.Members), controlPlanes)
+	}
+	return nil
+}
+
+// nodeRejoined checks the node booted the target version, Talos reports it
+// running and ready, and the cluster passes the health gate again
+func (o *Orchestrator) nodeRejoined(ctx context.Context, run *metrics.UpgradeRun, step *metrics.UpgradeStep) error {
+	status, err := o.talos.GetNodeStatus(ctx, step.IP)
+	if err != nil {
+		return err
+	}
+	switch {
+	case !status.Reachable:
+		return fmt.Errorf("Talos API not reachable yet: %s", status.Error)
+	case status.Version != run.TargetVersion:
+		return fmt.Errorf("still runs %s", status.Version)
+	case status.Stage != "running" || !status.MachineReady:
+		return fmt.Errorf("machine stage %s, ready %t", status.Stage, status.MachineReady)
+	case !status.Healthy:
+		return fmt.Errorf("Talos services not healthy yet: %s", status.Error)
+	}
+	return o.clusterHealth(ctx)
+}
+
+// waitFor polls check until it passes or timeout expires, showing why it has not
+// passed yet as the step message
+func (o *Orchestrator) waitFor(ctx context.Context, run *metrics.UpgradeRun, i int, timeout time.Duration, check func(context.Context) error) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for {
+		err := check(ctx)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return fmt.Errorf("gave up after %s: %v", timeout, err)
+		}
+		run.Steps[i].Message = err.Error()
+		if err := o.save(run); err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("gave up after %s: %v", timeout, err)
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// enter moves a step to the next phase and records it
+func (o *Orchestrator) enter(run *metrics.UpgradeRun, i int, phase, message string) error {
+	step := &run.Steps[i]
+	step.Phase = phase
+	step.Message = message
+	event := phase
+	if message != "" {
+		event += ": " + message
+	}
+	addEvent(run, step.Node, event)
+	return o.save(run)
+}
+
+// save writes the run's progress unless it was aborted or taken over meanwhile,
+// in which case it cancels this replica's execution and returns errAborted.
+// Failed writes are retried for saveTimeout, then logged: the next write catches
+// up, and a missed one must not fail the upgrade.
+func (o *Orchestrator) save(run *metrics.UpgradeRun) error {
+	err := o.saveWithin(run, saveTimeout)
+	if err != nil && !errors.Is(err, errAborted) {
+		log.Printf("Warning: failed to save upgrade %s progress: %v", run.ID, err)
+		return nil
+	}
+	return err
+}
+
+// saveFinal writes the state a run ended in. It keeps retrying for as long as
+// the lease would have lasted, as the API may be down while a control plane reboots.
+func (o *Orchestrator) saveFinal(run *metrics.UpgradeRun) {
+	err := o.saveWithin(run, leaseDuration)
+	if err != nil && !errors.Is(err, errAborted) {
+		log.Printf("Error: upgrade %s ended %s but could not be saved, it shows as interrupted once the lease expires: %v",
+			run.ID, strings.ToLower(run.State), err)
+	}
+}
+
+// saveWithin writes the run, retrying failed writes until timeout
+func (o *Orchestrator) saveWithin(run *metrics.UpgradeRun, timeout time.Duration) error {
+	// The run context may be cancelled already when a pause is recorded during shutdown
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	delay := time.Second
+	for {
+		err := o.trySave(ctx, run)
+		if err == nil || errors.Is(err, errAborted) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		delay = min(2*delay, renewInterval)
+	}
+}
+
+// trySave makes one attempt at writing the run
+func (o *Orchestrator) trySave(ctx context.Context, run *metrics.UpgradeRun) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	attemptCtx, cancel := context.WithTimeout(ctx, saveTimeout)
+	defer cancel()
+
+	stored, err := o.store.LoadUpgradeRun(attemptCtx)
+	if err != nil {
+		return err
+	}
+	if stored == nil || stored.ID != run.ID || stored.State != metrics.UpgradeRunning || stored.Owner != o.owner {
+		if o.cancel != nil {
+			o.cancel()
+		}
+		return errAborted
+	}
+
+	run.Heartbeat = time.Now()
+	return o.store.SaveUpgradeRun(attemptCtx, run)
+}
+
+// addEvent records a progress line, newest first, and writes it to the process log
+func addEvent(run *metrics.UpgradeRun, node, message string) {
+	if node != "" {
+		log.Printf("upgrade %s: %s: %s", run.ID, node, message)
+	} else {
+		log.Printf("upgrade %s: %s", run.ID, message)
+	}
+	run.Events = append([]metrics.UpgradeEvent{{Time: time.Now(), Node: node, Message: message}}, run.Events...)
+	if len(run.Events) > maxEvents {
+		run.Events = run.Events[:maxEvents]
+	}
+}
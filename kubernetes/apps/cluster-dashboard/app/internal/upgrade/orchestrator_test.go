@@ -0,0 +1,496 @@
+package upgrade
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pi-cluster/cluster-dashboard/internal/metrics"
+	"github.com/pi-cluster/cluster-dashboard/internal/talos"
+)
+
+const (
+	testImage       = "factory.talos.dev/installer/abc123:v1.11.6"
+	testKubeVersion = "v1.33.5"
+)
+
+// fakeKube is a cluster of three control planes and two workers running
+// Kubernetes testKubeVersion
+type fakeKube struct {
+	mu               sync.Mutex
+	nodes            []metrics.NodeDetail
+	notReady         map[string]bool
+	controlPlane     map[string]map[string]string // Node -> component -> version
+	kubeProxy        string
+	kubeProxyRolling bool
+	actions          []string
+}
+
+func newFakeKube() *fakeKube {
+	k := &fakeKube{
+		nodes: []metrics.NodeDetail{
+			{Name: "cp1", IP: "10.0.0.1", Role: "control-plane"},
+			{Name: "cp2", IP: "10.0.0.2", Role: "control-plane"},
+			{Name: "cp3", IP: "10.0.0.3", Role: "control-plane"},
+			{Name: "w1", IP: "10.0.0.11", Role: "worker"},
+			{Name: "w2", IP: "10.0.0.12", Role: "worker"},
+		},
+		notReady:     map[string]bool{},
+		controlPlane: map[string]map[string]string{},
+		kubeProxy:    testKubeVersion,
+	}
+	for i, node := range k.nodes {
+		k.nodes[i].KubeletVersion = testKubeVersion
+		if node.Role == "control-plane" {
+			k.controlPlane[node.Name] = map[string]string{}
+			for _, name := range controlPlaneComponents {
+				k.controlPlane[node.Name][name] = testKubeVersion
+			}
+		}
+	}
+	return k
+}
+
+func (k *fakeKube) GetNodeMetrics(ctx context.Context) ([]metrics.NodeDetail, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	nodes := make([]metrics.NodeDetail, len(k.nodes))
+	copy(nodes, k.nodes)
+	for i := range nodes {
+		nodes[i].IsReady = !k.notReady[nodes[i].Name]
+	}
+	return nodes, nil
+}
+
+func (k *fakeKube) CordonNode(ctx context.Context, name string, cordon bool) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if cordon {
+		k.actions = append(k.actions, "cordon "+name)
+	} else {
+		k.actions = append(k.actions, "uncordon "+name)
+	}
+	return nil
+}
+
+func (k *fakeKube) DrainNode(ctx context.Context, name string, progress func(remaining []string)) error {
+	k.mu.Lock()
+	k.actions = append(k.actions, "drain "+name)
+	k.mu.Unlock()
+	progress([]string{"default/app"})
+	return nil
+}
+
+func (k *fakeKube) ControlPlaneVersions(ctx context.Context, node string) (map[string]string, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	versions := map[string]string{}
+	for name, version := range k.controlPlane[node] {
+		versions[name] = version
+	}
+	return versions, nil
+}
+
+// KubeProxyVersion reports a rollout in progress once after the version was set
+func (k *fakeKube) KubeProxyVersion(ctx context.Context) (string, bool, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	rolledOut := !k.kubeProxyRolling
+	k.kubeProxyRolling = false
+	return k.kubeProxy, rolledOut, nil
+}
+
+func (k *fakeKube) SetKubeProxyVersion(ctx context.Context, version string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.kubeProxy = version
+	k.kubeProxyRolling = true
+	k.actions = append(k.actions, "set kube-proxy "+version)
+	return nil
+}
+
+func (k *fakeKube) setKubeletVersion(name, version string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	for i := range k.nodes {
+		if k.nodes[i].Name == name {
+			k.nodes[i].KubeletVersion = version
+		}
+	}
+}
+
+func (k *fakeKube) setControlPlaneVersions(name string, versions map[string]string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	for component, version := range versions {
+		k.controlPlane[name][component] = version
+	}
+}
+
+func (k *fakeKube) record(action string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.actions = append(k.actions, action)
+}
+
+func (k *fakeKube) setReady(name string, ready bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.notReady[name] = !ready
+}
+
+func (k *fakeKube) actionLog() []string {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return append([]string(nil), k.actions...)
+}
+
+// fakeStore keeps the run as JSON, like the ConfigMap, so no state is shared with the orchestrator
+type fakeStore struct {
+	mu           sync.Mutex
+	run          []byte
+	holder       string
+	leaseExpires time.Time
+}
+
+func (s *fakeStore) LoadUpgradeRun(ctx context.Context) (*metrics.UpgradeRun, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.run == nil {
+		return nil, nil
+	}
+	var run metrics.UpgradeRun
+	if err := json.Unmarshal(s.run, &run); err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+func (s *fakeStore) SaveUpgradeRun(ctx context.Context, run *metrics.UpgradeRun) error {
+	data, err := json.Marshal(run)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.run = data
+	return nil
+}
+
+func (s *fakeStore) AcquireUpgradeLease(ctx context.Context, holder string, duration time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.holder != "" && s.holder != holder && time.Now().Before(s.leaseExpires) {
+		return fmt.Errorf("%w: %s", metrics.ErrLeaseHeld, s.holder)
+	}
+	s.holder = holder
+	s.leaseExpires = time.Now().Add(duration)
+	return nil
+}
+
+func (s *fakeStore) ReleaseUpgradeLease(ctx context.Context, holder string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.holder == holder {
+		s.holder = ""
+	}
+	return nil
+}
+
+func (s *fakeStore) UpgradeLeaseHolder(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !time.Now().Before(s.leaseExpires) {
+		return "", nil
+	}
+	return s.holder, nil
+}
+
+func (s *fakeStore) setLease(holder string, expires time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.holder = holder
+	s.leaseExpires = expires
+}
+
+func (s *fakeStore) leaseHolder() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.holder
+}
+
+// newTestOrchestrator returns an orchestrator with the waits shortened, on a
+// fake cluster and store and the real Talos client talking to a fake Talos API
+func newTestOrchestrator(t *testing.T, gate time.Duration) (*Orchestrator, *fakeKube, *fakeTalosAPI, *fakeStore) {
+	t.Helper()
+
+	saved := []time.Duration{pollInterval, gateTimeout, drainTimeout, rejoinTimeout}
+	pollInterval, gateTimeout, drainTimeout, rejoinTimeout = 5*time.Millisecond, gate, time.Second, time.Second
+	t.Cleanup(func() {
+		pollInterval, gateTimeout, drainTimeout, rejoinTimeout = saved[0], saved[1], saved[2], saved[3]
+	})
+	t.Setenv("POD_NAME", "replica-a")
+	t.Setenv("NODE_NAME", "")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	kube := newFakeKube()
+	api := newFakeTalosAPI(t, kube)
+	client, err := talos.NewClient()
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	store := &fakeStore{}
+	return NewOrchestrator(ctx, kube, client, store), kube, api, store
+}
+
+// waitForState polls the run until it reaches state and this replica stopped executing it
+func waitForState(t *testing.T, o *Orchestrator, store *fakeStore, state string) *metrics.UpgradeRun {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		run, err := o.Current(context.Background())
+		if err != nil {
+			t.Fatalf("Current: %v", err)
+		}
+		o.mu.Lock()
+		idle := o.cancel == nil
+		o.mu.Unlock()
+		if run != nil && run.State == state && idle && store.leaseHolder() != o.owner {
+			return run
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("run did not reach %s: %+v", state, run)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestUpgradeOrder(t *testing.T) {
+	o, kube, talos, store := newTestOrchestrator(t, time.Second)
+
+	run, err := o.Preview(context.Background(), testImage, "", "admin")
+	if err != nil {
+		t.Fatalf("Preview: %v", err)
+	}
+	var order []string
+	for _, step := range run.Steps {
+		order = append(order, step.Node)
+	}
+	want := []string{"w1", "w2", "cp1", "cp3", "cp2"}
+	if !reflect.DeepEqual(order, want) {
+		t.Fatalf("planned order = %v, want workers first and the etcd leader last: %v", order, want)
+	}
+
+	if err := o.Start(context.Background(), "admin"); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	run = waitForState(t, o, store, metrics.UpgradeCompleted)
+
+	wantIPs := []string{"10.0.0.11", "10.0.0.12", "10.0.0.1", "10.0.0.3", "10.0.0.2"}
+	if got := talos.upgradedNodes(); !reflect.DeepEqual(got, wantIPs) {
+		t.Errorf("upgraded %v, want %v", got, wantIPs)
+	}
+	var wantActions []string
+	for _, node := range want {
+		wantActions = append(wantActions, "cordon "+node, "drain "+node, "uncordon "+node)
+	}
+	if got := kube.actionLog(); !reflect.DeepEqual(got, wantActions) {
+		t.Errorf("node actions = %v, want %v", got, wantActions)
+	}
+	for _, step := range run.Steps {
+		if step.Phase != metrics.PhaseDone || step.Failed {
+			t.Errorf("step %s ended at %q, failed %t", step.Node, step.Phase, step.Failed)
+		}
+	}
+}
+
+func TestKubernetesUpgradeOrder(t *testing.T) {
+	o, kube, api, store := newTestOrchestrator(t, time.Second)
+
+	for _, versions := range [][2]string{{"", ""}, {"", "1.34"}, {"", "v1.34.1-rc.0"}} {
+		if _, err := o.Preview(context.Background(), versions[0], versions[1], "admin"); !errors.Is(err, ErrInvalidImage) && !errors.Is(err, ErrInvalidVersion) {
+			t.Errorf("Preview(%q, %q): err = %v, want an invalid target", versions[0], versions[1], err)
+		}
+	}
+
+	kube.setKubeletVersion("w2", "v1.34.1")
+	run, err := o.Preview(context.Background(), "", "1.34.1", "admin")
+	if err != nil {
+		t.Fatalf("Preview: %v", err)
+	}
+	if run.KubernetesVersion != "v1.34.1" {
+		t.Errorf("target = %q, want v1.34.1", run.KubernetesVersion)
+	}
+	var order []string
+	for _, step := range run.Steps {
+		order = append(order, step.Component+" "+step.Node)
+	}
+	want := []string{
+		"Control plane cp1", "Control plane cp3", "Control plane cp2",
+		"kube-proxy kube-proxy",
+		"Kubelet cp1", "Kubelet cp3", "Kubelet cp2", "Kubelet w1", "Kubelet w2",
+	}
+	if !reflect.DeepEqual(order, want) {
+		t.Fatalf("planned order = %v, want %v", order, want)
+	}
+	if last := run.Steps[len(run.Steps)-1]; last.Phase != metrics.PhaseDone {
+		t.Errorf("w2's kubelet already runs the target but is planned %q", last.Phase)
+	}
+
+	if err := o.Start(context.Background(), "admin"); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	run = waitForState(t, o, store, metrics.UpgradeCompleted)
+
+	// Nothing is cordoned or rebooted, and no kubelet is upgraded before every API server
+	wantActions := []string{
+		"apply control plane cp1", "apply control plane cp3", "apply control plane cp2",
+		"set kube-proxy v1.34.1",
+		"apply kubelet cp1", "apply kubelet cp3", "apply kubelet cp2", "apply kubelet w1",
+	}
+	if got := kube.actionLog(); !reflect.DeepEqual(got, wantActions) {
+		t.Errorf("actions = %v, want %v", got, wantActions)
+	}
+	if got := api.upgradedNodes(); len(got) != 0 {
+		t.Errorf("Talos was upgraded on %v", got)
+	}
+	for _, step := range run.Steps {
+		if step.Phase != metrics.PhaseDone || step.Failed {
+			t.Errorf("step %s %s ended at %q, failed %t", step.Component, step.Node, step.Phase, step.Failed)
+		}
+	}
+
+	cfg, err := api.machineConfig("10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	images := kubernetesImages(cfg.Provider().RawV1Alpha1())
+	wantImages := map[string]string{
+		"kubelet":                 "mirror.local/siderolabs/kubelet:v1.34.1",
+		"kube-apiserver":          "registry.k8s.io/kube-apiserver:v1.34.1",
+		"kube-controller-manager": "registry.k8s.io/kube-controller-manager:v1.34.1",
+		"kube-scheduler":          "registry.k8s.io/kube-scheduler:v1.34.1",
+	}
+	if !reflect.DeepEqual(images, wantImages) {
+		t.Errorf("cp1 images = %v, want %v", images, wantImages)
+	}
+}
+
+func TestHealthGatePausesAndResumes(t *testing.T) {
+	o, kube, talos, store := newTestOrchestrator(t, 50*time.Millisecond)
+
+	kube.setReady("cp3", false)
+	if _, err := o.Preview(context.Background(), testImage, "", "admin"); err != nil {
+		t.Fatalf("Preview: %v", err)
+	}
+	if err := o.Start(context.Background(), "admin"); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	run := waitForState(t, o, store, metrics.UpgradePaused)
+	step := run.Steps[0]
+	if step.Node != "w1" || step.Phase != metrics.PhaseGate || !step.Failed {
+		t.Errorf("paused at %s %q failed %t, want the health gate of w1", step.Node, step.Phase, step.Failed)
+	}
+	if !strings.Contains(run.Message, "nodes not Ready: cp3") {
+		t.Errorf("message %q does not give the gate's reason", run.Message)
+	}
+	if got := kube.actionLog(); len(got) != 0 {
+		t.Errorf("nodes were touched behind a failed gate: %v", got)
+	}
+
+	kube.setReady("cp3", true)
+	if err := o.Start(context.Background(), "admin"); err != nil {
+		t.Fatalf("resume: %v", err)
+	}
+	run = waitForState(t, o, store, metrics.UpgradeCompleted)
+	if got := len(talos.upgradedNodes()); got != len(run.Steps) {
+		t.Errorf("upgraded %d nodes after resuming, want %d", got, len(run.Steps))
+	}
+	if run.Steps[0].Failed {
+		t.Error("the retried step is still marked failed")
+	}
+}
+
+func TestAbortStopsRun(t *testing.T) {
+	o, kube, talos, store := newTestOrchestrator(t, time.Minute)
+
+	kube.setReady("cp3", false)
+	if _, err := o.Preview(context.Background(), testImage, "", "admin"); err != nil {
+		t.Fatalf("Preview: %v", err)
+	}
+	if err := o.Start(context.Background(), "admin"); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if err := o.Abort(context.Background(), "admin"); err != nil {
+		t.Fatalf("Abort: %v", err)
+	}
+
+	run := waitForState(t, o, store, metrics.UpgradeAborted)
+	if !strings.Contains(run.Message, "Aborted by admin") {
+		t.Errorf("message = %q", run.Message)
+	}
+	if got := talos.upgradedNodes(); len(got) != 0 {
+		t.Errorf("nodes were upgraded after the abort: %v", got)
+	}
+	if err := o.Start(context.Background(), "admin"); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("starting an aborted run: err = %v, want ErrInvalidState", err)
+	}
+	if err := o.Abort(context.Background(), "admin"); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("aborting twice: err = %v, want ErrInvalidState", err)
+	}
+}
+
+func TestResumeWaitsForLease(t *testing.T) {
+	o, _, _, store := newTestOrchestrator(t, time.Second)
+
+	run, err := o.Preview(context.Background(), testImage, "", "admin")
+	if err != nil {
+		t.Fatalf("Preview: %v", err)
+	}
+	// Another replica runs the upgrade and has not written for a while, e.g. while
+	// the API is down during a control-plane reboot
+	run.State = metrics.UpgradeRunning
+	run.Owner = "replica-b"
+	run.Heartbeat = time.Now().Add(-time.Hour)
+	if err := store.SaveUpgradeRun(context.Background(), run); err != nil {
+		t.Fatal(err)
+	}
+	store.setLease("replica-b", time.Now().Add(time.Minute))
+
+	run, err = o.Current(context.Background())
+	if err != nil {
+		t.Fatalf("Current: %v", err)
+	}
+	if run.State != metrics.UpgradeRunning {
+		t.Fatalf("state = %s while the owner holds the lease, want Running", run.State)
+	}
+	if err := o.Start(context.Background(), "admin"); !errors.Is(err, ErrInvalidState) {
+		t.Fatalf("Start while another replica holds the lease: err = %v, want ErrInvalidState", err)
+	}
+
+	store.setLease("replica-b", time.Now().Add(-time.Second))
+	run, err = o.Current(context.Background())
+	if err != nil {
+		t.Fatalf("Current: %v", err)
+	}
+	if run.State != metrics.UpgradePaused {
+		t.Fatalf("state = %s once the lease expired, want Paused", run.State)
+	}
+	if err := o.Start(context.Background(), "admin"); err != nil {
+		t.Fatalf("resume after the lease expired: %v", err)
+	}
+	run = waitForState(t, o, store, metrics.UpgradeCompleted)
+	if run.Owner != "replica-a" {
+		t.Errorf("owner = %s, want replica-a", run.Owner)
+	}
+}
@@ -0,0 +1,535 @@
+package upgrade
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	cosiapi "github.com/cosi-project/runtime/api/v1alpha1"
+	"github.com/cosi-project/runtime/pkg/state"
+	"github.com/cosi-project/runtime/pkg/state/impl/inmem"
+	"github.com/cosi-project/runtime/pkg/state/impl/namespaced"
+	"github.com/cosi-project/runtime/pkg/state/protobuf/server"
+	"github.com/siderolabs/talos/pkg/machinery/api/common"
+	machineapi "github.com/siderolabs/talos/pkg/machinery/api/machine"
+	clientconfig "github.com/siderolabs/talos/pkg/machinery/client/config"
+	"github.com/siderolabs/talos/pkg/machinery/config/configloader"
+	"github.com/siderolabs/talos/pkg/machinery/config/container"
+	"github.com/siderolabs/talos/pkg/machinery/config/types/v1alpha1"
+	"github.com/siderolabs/talos/pkg/machinery/resources/config"
+	"github.com/siderolabs/talos/pkg/machinery/resources/runtime"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// rebootTime is how long a fake node is unreachable while it reboots into a new version
+const rebootTime = 20 * time.Millisecond
+
+// fakeTalosAPI is the Talos API of the fake cluster, served over mTLS like
+// apid: the machine service and the COSI state of every node behind one
+// endpoint, picked by the node metadata the client sets. Upgrades reboot the
+// node into the new version; applied machine configs move the node's
+// Kubernetes components in fakeKube. Calls that change a node need a client
+// certificate with the os:admin role.
+type fakeTalosAPI struct {
+	machineapi.UnimplementedMachineServiceServer
+
+	kube *fakeKube
+
+	mu       sync.Mutex
+	leader   string
+	nodes    map[string]*fakeTalosNode // By IP
+	upgraded []string                  // IPs, in the order they were upgraded
+}
+
+// fakeTalosNode is one node's machine state
+type fakeTalosNode struct {
+	name         string
+	ip           string
+	controlPlane bool
+	version      string
+	rebootUntil  time.Time
+	state        state.State
+}
+
+// newFakeTalosAPI serves the Talos API for the nodes of kube and points the
+// talosconfig variables NewClient reads at it
+func newFakeTalosAPI(t *testing.T, kube *fakeKube) *fakeTalosAPI {
+	t.Helper()
+
+	api := &fakeTalosAPI{kube: kube, leader: "cp2", nodes: map[string]*fakeTalosNode{}}
+	var ips []string
+	for _, node := range kube.nodes {
+		n := &fakeTalosNode{
+			name:         node.Name,
+			ip:           node.IP,
+			controlPlane: node.Role == "control-plane",
+			version:      "v1.11.5",
+			state:        state.WrapCore(namespaced.NewState(inmem.Build)),
+		}
+		n.bootstrap(t)
+		api.nodes[node.IP] = n
+		ips = append(ips, node.IP)
+	}
+
+	ca := newTestCA(t)
+	serverCert, serverKey := ca.issue(t, "apid", "", x509.ExtKeyUsageServerAuth)
+	keyPair, err := tls.X509KeyPair(serverCert, serverKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer(grpc.Creds(credentials.NewTLS(&tls.Config{
+		Certificates: []tls.Certificate{keyPair},
+		ClientCAs:    ca.pool(),
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	})))
+	machineapi.RegisterMachineServiceServer(srv, api)
+	cosiapi.RegisterStateServer(srv, fakeCOSI{api: api})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(listener)
+	t.Cleanup(srv.Stop)
+
+	dir := t.TempDir()
+	endpoint := listener.Addr().String()
+	t.Setenv("TALOSCONFIG", writeTalosconfig(t, dir, "reader", endpoint, ca, "os:reader"))
+	t.Setenv("TALOSCONFIG_ELEVATED", writeTalosconfig(t, dir, "admin", endpoint, ca, "os:admin"))
+	t.Setenv("TALOS_NODES", strings.Join(ips, ","))
+	return api
+}
+
+// bootstrap creates the resources a running node reports: its machine status
+// and a machine config with the Kubernetes images of fakeKube
+func (n *fakeTalosNode) bootstrap(t *testing.T) {
+	t.Helper()
+
+	machine := runtime.NewMachineStatus()
+	machine.TypedSpec().Stage = runtime.MachineStageRunning
+	machine.TypedSpec().Status.Ready = true
+	if err := n.state.Create(context.Background(), machine); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &v1alpha1.Config{
+		ConfigVersion: "v1alpha1",
+		MachineConfig: &v1alpha1.MachineConfig{
+			MachineType: "worker",
+			// A mirror, to check the repository is kept
+			MachineKubelet: &v1alpha1.KubeletConfig{KubeletImage: "mirror.local/siderolabs/kubelet:" + testKubeVersion},
+		},
+		ClusterConfig: &v1alpha1.ClusterConfig{},
+	}
+	if n.controlPlane {
+		cfg.MachineConfig.MachineType = "controlplane"
+		cfg.ClusterConfig.APIServerConfig = &v1alpha1.APIServerConfig{ContainerImage: "registry.k8s.io/kube-apiserver:" + testKubeVersion}
+		cfg.ClusterConfig.ControllerManagerConfig = &v1alpha1.ControllerManagerConfig{ContainerImage: "registry.k8s.io/kube-controller-manager:" + testKubeVersion}
+		// Unset: Talos' default repository applies
+		cfg.ClusterConfig.SchedulerConfig = nil
+	}
+	provider, err := container.New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := n.state.Create(context.Background(), config.NewMachineConfig(provider)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// node returns the node a call is addressed to, or Unavailable while it reboots
+func (a *fakeTalosAPI) node(ctx context.Context) (fakeTalosNode, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	ips := md.Get("node")
+	if len(ips) != 1 {
+		return fakeTalosNode{}, status.Error(codes.InvalidArgument, "call not addressed to a single node")
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	node, ok := a.nodes[ips[0]]
+	if !ok {
+		return fakeTalosNode{}, status.Errorf(codes.Unavailable, "no route to %s", ips[0])
+	}
+	if time.Now().Before(node.rebootUntil) {
+		return fakeTalosNode{}, status.Errorf(codes.Unavailable, "%s is rebooting", ips[0])
+	}
+	return *node, nil
+}
+
+// requireAdmin rejects calls made with a client certificate without the os:admin role
+func requireAdmin(ctx context.Context) error {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return status.Error(codes.Unauthenticated, "no peer")
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.PeerCertificates) == 0 {
+		return status.Error(codes.Unauthenticated, "no client certificate")
+	}
+	if !slices.Contains(info.State.PeerCertificates[0].Subject.Organization, "os:admin") {
+		return status.Error(codes.PermissionDenied, "not authorized")
+	}
+	return nil
+}
+
+func (a *fakeTalosAPI) Version(ctx context.Context, _ *emptypb.Empty) (*machineapi.VersionResponse, error) {
+	node, err := a.node(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &machineapi.VersionResponse{Messages: []*machineapi.Version{{
+		Metadata: &common.Metadata{Hostname: node.name},
+		Version:  &machineapi.VersionInfo{Tag: node.version},
+	}}}, nil
+}
+
+func (a *fakeTalosAPI) ServiceList(ctx context.Context, _ *emptypb.Empty) (*machineapi.ServiceListResponse, error) {
+	node, err := a.node(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ids := []string{"apid", "containerd", "kubelet"}
+	if node.controlPlane {
+		ids = append(ids, "etcd", "trustd")
+	}
+	services := make([]*machineapi.ServiceInfo, 0, len(ids))
+	for _, id := range ids {
+		services = append(services, &machineapi.ServiceInfo{
+			Id:     id,
+			State:  "Running",
+			Health: &machineapi.ServiceHealth{Healthy: true},
+		})
+	}
+	return &machineapi.ServiceListResponse{Messages: []*machineapi.ServiceList{{Services: services}}}, nil
+}
+
+func (a *fakeTalosAPI) EtcdMemberList(ctx context.Context, _ *machineapi.EtcdMemberListRequest) (*machineapi.EtcdMemberListResponse, error) {
+	node, err := a.node(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !node.controlPlane {
+		return nil, status.Error(codes.Unimplemented, "etcd is not running on workers")
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var members []*machineapi.EtcdMember
+	for _, n := range a.nodes {
+		if n.controlPlane {
+			members = append(members, &machineapi.EtcdMember{
+				Id:         memberID(n.name),
+				Hostname:   n.name,
+				ClientUrls: []string{"https://" + n.ip + ":2379"},
+			})
+		}
+	}
+	return &machineapi.EtcdMemberListResponse{Messages: []*machineapi.EtcdMembers{{Members: members}}}, nil
+}
+
+func (a *fakeTalosAPI) EtcdStatus(ctx context.Context, _ *emptypb.Empty) (*machineapi.EtcdStatusResponse, error) {
+	node, err := a.node(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !node.controlPlane {
+		return nil, status.Error(codes.Unimplemented, "etcd is not running on workers")
+	}
+	a.mu.Lock()
+	leader := memberID(a.leader)
+	a.mu.Unlock()
+	return &machineapi.EtcdStatusResponse{Messages: []*machineapi.EtcdStatus{{
+		MemberStatus: &machineapi.EtcdMemberStatus{
+			MemberId:         memberID(node.name),
+			Leader:           leader,
+			RaftTerm:         2,
+			RaftIndex:        1000,
+			RaftAppliedIndex: 1000,
+			DbSize:           1 << 20,
+			DbSizeInUse:      1 << 20,
+		},
+	}}}, nil
+}
+
+func (a *fakeTalosAPI) EtcdAlarmList(ctx context.Context, _ *emptypb.Empty) (*machineapi.EtcdAlarmListResponse, error) {
+	if _, err := a.node(ctx); err != nil {
+		return nil, err
+	}
+	return &machineapi.EtcdAlarmListResponse{Messages: []*machineapi.EtcdAlarm{{}}}, nil
+}
+
+// Upgrade reboots the node into the image's version, taking it out of the
+// cluster for rebootTime
+func (a *fakeTalosAPI) Upgrade(ctx context.Context, req *machineapi.UpgradeRequest) (*machineapi.UpgradeResponse, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	node, err := a.node(ctx)
+	if err != nil {
+		return nil, err
+	}
+	version, err := imageVersion(req.GetImage())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if !req.GetPreserve() {
+		return nil, status.Error(codes.InvalidArgument, "upgrade would wipe EPHEMERAL")
+	}
+
+	a.mu.Lock()
+	a.nodes[node.ip].version = version
+	a.nodes[node.ip].rebootUntil = time.Now().Add(rebootTime)
+	a.upgraded = append(a.upgraded, node.ip)
+	a.mu.Unlock()
+
+	a.kube.setReady(node.name, false)
+	time.AfterFunc(rebootTime, func() { a.kube.setReady(node.name, true) })
+	return &machineapi.UpgradeResponse{Messages: []*machineapi.Upgrade{{Ack: "Upgrade request received"}}}, nil
+}
+
+// ApplyConfiguration stores the config and restarts the Kubernetes components
+// whose images it changed, reporting their new versions through fakeKube
+func (a *fakeTalosAPI) ApplyConfiguration(ctx context.Context, req *machineapi.ApplyConfigurationRequest) (*machineapi.ApplyConfigurationResponse, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	node, err := a.node(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if req.GetMode() != machineapi.ApplyConfigurationRequest_NO_REBOOT {
+		return nil, status.Errorf(codes.InvalidArgument, "unexpected mode %s", req.GetMode())
+	}
+	provider, err := configloader.NewFromBytes(req.GetData())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	old, err := a.machineConfig(node.ip)
+	if err != nil {
+		return nil, err
+	}
+	applied := config.NewMachineConfig(provider)
+	applied.Metadata().SetVersion(old.Metadata().Version())
+	if err := node.state.Update(ctx, applied); err != nil {
+		return nil, err
+	}
+
+	before, after := kubernetesImages(old.Provider().RawV1Alpha1()), kubernetesImages(provider.RawV1Alpha1())
+	if before["kubelet"] != after["kubelet"] {
+		a.kube.setKubeletVersion(node.name, imageTagOf(after["kubelet"]))
+		a.kube.record("apply kubelet " + node.name)
+	}
+	controlPlane := map[string]string{}
+	for _, name := range controlPlaneComponents {
+		if before[name] != after[name] {
+			controlPlane[name] = imageTagOf(after[name])
+		}
+	}
+	if len(controlPlane) > 0 {
+		a.kube.setControlPlaneVersions(node.name, controlPlane)
+		a.kube.record("apply control plane " + node.name)
+	}
+	return &machineapi.ApplyConfigurationResponse{Messages: []*machineapi.ApplyConfiguration{{Mode: req.GetMode()}}}, nil
+}
+
+// machineConfig returns the config a node runs
+func (a *fakeTalosAPI) machineConfig(ip string) (*config.MachineConfig, error) {
+	a.mu.Lock()
+	node := a.nodes[ip]
+	a.mu.Unlock()
+	r, err := node.state.Get(context.Background(), config.NewMachineConfig(nil).Metadata())
+	if err != nil {
+		return nil, err
+	}
+	return r.(*config.MachineConfig), nil
+}
+
+// fakeCOSI serves COSI resources from the state of the node a call is addressed to
+type fakeCOSI struct {
+	cosiapi.UnimplementedStateServer
+
+	api *fakeTalosAPI
+}
+
+func (c fakeCOSI) Get(ctx context.Context, req *cosiapi.GetRequest) (*cosiapi.GetResponse, error) {
+	node, err := c.api.node(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return server.NewState(node.state).Get(ctx, req)
+}
+
+func (c fakeCOSI) List(req *cosiapi.ListRequest, srv cosiapi.State_ListServer) error {
+	node, err := c.api.node(srv.Context())
+	if err != nil {
+		return err
+	}
+	return server.NewState(node.state).List(req, srv)
+}
+
+func (a *fakeTalosAPI) upgradedNodes() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]string(nil), a.upgraded...)
+}
+
+// kubernetesImages returns the Kubernetes images set in a machine config, by component
+func kubernetesImages(cfg *v1alpha1.Config) map[string]string {
+	images := map[string]string{}
+	if kubelet := cfg.MachineConfig.MachineKubelet; kubelet != nil {
+		images["kubelet"] = kubelet.KubeletImage
+	}
+	if cluster := cfg.ClusterConfig; cluster != nil {
+		if cluster.APIServerConfig != nil {
+			images["kube-apiserver"] = cluster.APIServerConfig.ContainerImage
+		}
+		if cluster.ControllerManagerConfig != nil {
+			images["kube-controller-manager"] = cluster.ControllerManagerConfig.ContainerImage
+		}
+		if cluster.SchedulerConfig != nil {
+			images["kube-scheduler"] = cluster.SchedulerConfig.ContainerImage
+		}
+	}
+	return images
+}
+
+// imageTagOf returns the tag of an image reference
+func imageTagOf(image string) string {
+	return image[strings.LastIndex(image, ":")+1:]
+}
+
+// memberID gives each control plane a stable etcd member ID
+func memberID(hostname string) uint64 {
+	var id uint64 = 1
+	for _, b := range []byte(hostname) {
+		id = id*31 + uint64(b)
+	}
+	return id
+}
+
+// testCA signs the fake apid's certificate and the talosconfig client certificates
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{Organization: []string{"talos"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+func (ca *testCA) pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	return pool
+}
+
+// issue signs a certificate for 127.0.0.1 with role as its organization, the
+// way Talos carries roles in client certificates, and returns it and its key as PEM
+func (ca *testCA) issue(t *testing.T, name, role string, usage x509.ExtKeyUsage) ([]byte, []byte) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	if role != "" {
+		template.Subject.Organization = []string{role}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// writeTalosconfig writes a talosconfig for endpoint with a client certificate
+// carrying role, and returns its path
+func writeTalosconfig(t *testing.T, dir, name, endpoint string, ca *testCA, role string) string {
+	t.Helper()
+
+	crt, key := ca.issue(t, name, role, x509.ExtKeyUsageClientAuth)
+	cfg := &clientconfig.Config{
+		Context: "test",
+		Contexts: map[string]*clientconfig.Context{
+			"test": {
+				Endpoints: []string{endpoint},
+				CA:        base64.StdEncoding.EncodeToString(ca.pem),
+				Crt:       base64.StdEncoding.EncodeToString(crt),
+				Key:       base64.StdEncoding.EncodeToString(key),
+			},
+		},
+	}
+	data, err := cfg.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
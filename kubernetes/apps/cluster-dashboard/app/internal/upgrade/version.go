@@ -0,0 +1,70 @@
+package upgrade
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ErrInvalidImage is returned when the installer image does not name a Talos version
+var ErrInvalidImage = errors.New("invalid installer image")
+
+// ErrInvalidVersion is returned when the Kubernetes version is not a release like v1.34.1
+var ErrInvalidVersion = errors.New("invalid Kubernetes version")
+
+// imageVersion returns the tag of an installer image, which has to be the Talos
+// version it installs, e.g. factory.talos.dev/installer/<schematic>:v1.11.6
+func imageVersion(image string) (string, error) {
+	if image == "" {
+		return "", fmt.Errorf("%w: none given", ErrInvalidImage)
+	}
+	// The last colon after the last slash separates the tag; an earlier one is a registry port
+	name := image[strings.LastIndex(image, "/")+1:]
+	_, tag, ok := strings.Cut(name, ":")
+	if !ok || strings.Contains(image, "@") {
+		return "", fmt.Errorf("%w: %q must be tagged with a Talos version, e.g. factory.talos.dev/installer/<schematic>:v1.11.6", ErrInvalidImage, image)
+	}
+	if _, _, ok := parseVersion(tag); !ok {
+		return "", fmt.Errorf("%w: tag %q is not a Talos version like v1.11.6", ErrInvalidImage, tag)
+	}
+	return tag, nil
+}
+
+// releasePattern matches a release tag without pre-release or build suffix
+var releasePattern = regexp.MustCompile(`^v\d+\.\d+\.\d+$`)
+
+// kubernetesVersion normalises a Kubernetes release to the form of image tags,
+// e.g. 1.34.1 to v1.34.1
+func kubernetesVersion(version string) (string, error) {
+	tag := "v" + strings.TrimPrefix(version, "v")
+	if !releasePattern.MatchString(tag) {
+		return "", fmt.Errorf("%w: %q is not a release like v1.34.1", ErrInvalidVersion, version)
+	}
+	return tag, nil
+}
+
+// versionWarning explains when going from one version to the other is not a
+// supported upgrade: Talos and the Kubernetes control plane have to be upgraded
+// one minor release at a time
+func versionWarning(from, to string) string {
+	fromMajor, fromMinor, ok := parseVersion(from)
+	if !ok {
+		return ""
+	}
+	toMajor, toMinor, _ := parseVersion(to)
+	switch {
+	case toMajor < fromMajor || (toMajor == fromMajor && toMinor < fromMinor):
+		return fmt.Sprintf("%s to %s is a downgrade", from, to)
+	case toMajor == fromMajor && toMinor > fromMinor+1:
+		return fmt.Sprintf("%s to %s skips a minor release: upgrade through each one in turn", from, to)
+	}
+	return ""
+}
+
+// parseVersion reads the major and minor release from a tag like v1.11.6
+func parseVersion(tag string) (major, minor int, ok bool) {
+	var patch int
+	n, _ := fmt.Sscanf(tag, "v%d.%d.%d", &major, &minor, &patch)
+	return major, minor, n == 3
+}
@@ -20,7 +20,8 @@ generate_controlplane_config() {
     # Determine storage patch file
     local storage_patch="${script_dir}/patches/node-1${node_num}-storage.yaml"
 
-    # Create network configuration patch
+    # Create network configuration patch (the dashboard's drift detection expects
+    # the same in flux/clusters/talos/apps/cluster-dashboard/talos-expected/)
     cat > "$temp_network" <<EOF
 machine:
   network:
@@ -63,7 +64,8 @@ generate_worker_config() {
     local hostname="talos-worker${node_num}"
     local temp_network="/tmp/node1${node_num}-network.yaml"
 
-    # Create network configuration patch
+    # Create network configuration patch (the dashboard's drift detection expects
+    # the same in flux/clusters/talos/apps/cluster-dashboard/talos-expected/)
     cat > "$temp_network" <<EOF
 machine:
   network: